@@ -0,0 +1,248 @@
+package eunomia
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrBatchWriterClosed = errors.New("cannot push through a closed batch writer")
+
+// The result of an asynchronous push, completed once the element is written to the queue (and synced, if the queue
+// durability policy requires it).
+type PushFuture struct {
+	done chan struct{}
+	err  error
+}
+
+// Blocks until the push is completed, and returns it's error.
+func (p *PushFuture) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// Returns a channel closed when the push is completed.
+func (p *PushFuture) Done() <-chan struct{} {
+	return p.done
+}
+
+func (p *PushFuture) complete(err error) {
+	p.err = err
+	close(p.done)
+}
+
+// Pushes elements to a FileQueue asynchronously, coalescing the pushes waiting to be written in a single batch.
+// A batch is written with one write of all it's elements, one header update and (with DurabilitySync) one sync,
+// instead of one of each per element, trading latency for throughput.
+//
+// Elements become visible to the consumers of the queue once their batch is written. With a bounded queue, every
+// element is checked against the capacity on it's own, so the futures of a batch can complete with different errors.
+type BatchWriter struct {
+	queue    *FileQueue
+	maxBatch int
+	linger   time.Duration
+	pending  []*batchElement
+	closed   bool
+	mu       sync.Mutex
+	// receives a value when elements are pending.
+	signal  chan struct{}
+	closing chan struct{}
+	stopped chan struct{}
+	// canceled by Close, to stop waiting for space in a full blocking queue.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type batchElement struct {
+	data   []byte
+	future *PushFuture
+}
+
+// Creates a batch writer on the given queue and starts it's background goroutine.
+// Batches contain at most maxBatch elements, and the writer waits for linger before writing a batch to give more
+// pushes a chance to join it, a linger of 0 writes whatever is pending as soon as possible.
+func NewBatchWriter(queue *FileQueue, maxBatch int, linger time.Duration) *BatchWriter {
+	ctx, cancel := context.WithCancel(context.Background())
+	writer := &BatchWriter{
+		queue:    queue,
+		ctx:      ctx,
+		cancel:   cancel,
+		maxBatch: maxBatch,
+		linger:   linger,
+		signal:   make(chan struct{}, 1),
+		closing:  make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go writer.run()
+	return writer
+}
+
+// Schedules the element to be pushed to the queue.
+func (w *BatchWriter) Push(element interface{}) *PushFuture {
+	future := &PushFuture{done: make(chan struct{})}
+	data := w.queue.serializer.Write(element)
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		future.complete(ErrBatchWriterClosed)
+		return future
+	}
+	w.pending = append(w.pending, &batchElement{data: data, future: future})
+	w.mu.Unlock()
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+	return future
+}
+
+// Writes the pending elements and stops the background goroutine, the pushes made after Close fail with
+// ErrBatchWriterClosed. The pending elements waiting for space in a full blocking queue are not written, and fail
+// with ErrBatchWriterClosed as well.
+func (w *BatchWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+	w.cancel()
+	close(w.closing)
+	<-w.stopped
+	return nil
+}
+
+func (w *BatchWriter) run() {
+	defer close(w.stopped)
+	for {
+		select {
+		case <-w.signal:
+			if w.linger > 0 {
+				select {
+				case <-time.After(w.linger):
+				case <-w.closing:
+				}
+			}
+		case <-w.closing:
+		}
+		for {
+			batch := w.take()
+			if len(batch) == 0 {
+				break
+			}
+			data := make([][]byte, len(batch))
+			for i, element := range batch {
+				data[i] = element.data
+			}
+			errs := w.queue.pushBatch(w.ctx, data)
+			for i, element := range batch {
+				if errs[i] == context.Canceled {
+					errs[i] = ErrBatchWriterClosed
+				}
+				element.future.complete(errs[i])
+			}
+		}
+		select {
+		case <-w.closing:
+			return
+		default:
+		}
+	}
+}
+
+// Removes and returns the next batch of pending elements.
+func (w *BatchWriter) take() []*batchElement {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	size := len(w.pending)
+	if w.maxBatch > 0 && size > w.maxBatch {
+		size = w.maxBatch
+	}
+	batch := w.pending[:size:size]
+	w.pending = w.pending[size:]
+	return batch
+}
+
+// Pushes the serialized elements with a single write, followed by a single header update, and returns the error of
+// every element.
+// The header is only written once the elements are, updating the head length in memory before is harmless.
+// Bounded queues need to check their capacity before every element, so the elements are pushed one by one like
+// separate pushes (waiting for space until the context is done with OverflowBlock), and only the sync is shared.
+func (f *FileQueue) pushBatch(ctx context.Context, elements [][]byte) []error {
+	errs := make([]error, len(elements))
+	fail := func(err error) []error {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = err
+			}
+		}
+		return errs
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.writable(); err != nil {
+		return fail(err)
+	}
+	header := f.writer.header
+	if header.flags&FlagBounded != 0 {
+		for i, data := range elements {
+			errs[i] = f.appendData(ctx, data)
+			if errs[i] == errDropped {
+				errs[i] = nil
+			}
+			if errs[i] != nil && errs[i] != ErrQueueFull && errs[i] != ctx.Err() {
+				// the file could not be written, the next elements are not attempted.
+				return fail(errs[i])
+			}
+		}
+		if err := f.sync(); err != nil {
+			return fail(err)
+		}
+		return errs
+	}
+	start := header.head.offset
+	index := header.head.index
+	if header.elementCount > 0 {
+		start = header.tail.offset + 8 + header.tail.length
+		index = header.tail.index + 1
+	} else {
+		// the head of an empty queue is the last polled element, which is overwritten.
+		f.moves++
+	}
+	size := 0
+	for _, data := range elements {
+		size += 8 + len(data)
+	}
+	chunk := make([]byte, 0, size)
+	var tail *elementPtr
+	for i, data := range elements {
+		frameStart := len(chunk)
+		chunk = append(chunk, 0, 0, 0, 0, 0, 0, 0, 0)
+		chunk = f.encode(chunk, data)
+		length := int64(len(chunk) - frameStart - 8)
+		putLong(chunk[frameStart:], length)
+		tail = &elementPtr{
+			offset: start + int64(frameStart),
+			length: length,
+			index:  index + int64(i),
+		}
+		if i == 0 && header.elementCount == 0 {
+			header.head.length = length
+		}
+	}
+	f.ahead.written(start, int64(len(chunk)))
+	if _, err := WriteChunk(f.writer.backingFile, start, chunk); err != nil {
+		return fail(err)
+	}
+	header.tail = tail
+	header.elementCount += int64(len(elements))
+	if err := writeHeader(f.writer.backingFile, header); err != nil {
+		return fail(err)
+	}
+	if err := f.sync(); err != nil {
+		return fail(err)
+	}
+	return errs
+}
@@ -0,0 +1,146 @@
+package eunomia
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatchWriter_PushesInOrder(t *testing.T) {
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
+		writer := NewBatchWriter(queue, 16, time.Millisecond)
+
+		futures := make([]*PushFuture, 0)
+		for i := 0; i < 100; i++ {
+			futures = append(futures, writer.Push(MockData{int32(i)}))
+		}
+		for _, future := range futures {
+			assert.NoError(t, future.Wait())
+		}
+		assert.NoError(t, writer.Close())
+
+		restored := open()
+		assert.Equal(t, int64(100), restored.Size())
+		for i := 0; i < 100; i++ {
+			el, err := restored.Poll()
+			assert.NoError(t, err)
+			assert.Equal(t, MockData{int32(i)}, el)
+		}
+	})
+}
+
+func TestBatchWriter_ConcurrentPushes(t *testing.T) {
+	queue, err := NewStorageQueue(NewMemoryStorage(), &MockDataSerializer{})
+	assert.NoError(t, err)
+	queue.SetDurability(DurabilitySync)
+	writer := NewBatchWriter(queue, 0, 0)
+
+	var wg sync.WaitGroup
+	for producer := 0; producer < 8; producer++ {
+		wg.Add(1)
+		go func(producer int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				assert.NoError(t, writer.Push(MockData{int32(producer*50 + i)}).Wait())
+			}
+		}(producer)
+	}
+	wg.Wait()
+	assert.NoError(t, writer.Close())
+
+	assert.Equal(t, int64(400), queue.Size())
+	seen := make(map[int32]bool)
+	for i := 0; i < 400; i++ {
+		el, err := queue.Poll()
+		assert.NoError(t, err)
+		seen[el.(MockData).value] = true
+	}
+	assert.Len(t, seen, 400)
+}
+
+func TestBatchWriter_PushAfterPolling(t *testing.T) {
+	queue, err := NewStorageQueue(NewMemoryStorage(), &MockDataSerializer{})
+	assert.NoError(t, err)
+	writer := NewBatchWriter(queue, 0, 0)
+	defer writer.Close()
+
+	assert.NoError(t, writer.Push(MockData{1}).Wait())
+	_, err = queue.Poll()
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Push(MockData{2}).Wait())
+	assert.NoError(t, writer.Push(MockData{3}).Wait())
+
+	el, err := queue.Get(1)
+	assert.NoError(t, err)
+	assert.Equal(t, MockData{3}, el)
+}
+
+func TestBatchWriter_BoundedQueue(t *testing.T) {
+	queue, err := NewBoundedFileQueue("bounded-queue", &MockDataSerializer{}, Capacity{MaxElements: 2})
+	assert.NoError(t, err)
+	defer queue.Delete()
+	writer := NewBatchWriter(queue, 0, 0)
+	defer writer.Close()
+
+	assert.NoError(t, writer.Push(MockData{1}).Wait())
+	assert.NoError(t, writer.Push(MockData{2}).Wait())
+	assert.Same(t, ErrQueueFull, writer.Push(MockData{3}).Wait())
+	assert.Equal(t, int64(2), queue.Size())
+}
+
+func TestBatchWriter_BoundedBatchCompletesEveryElement(t *testing.T) {
+	queue, err := NewBoundedFileQueue("bounded-queue", &MockDataSerializer{}, Capacity{MaxElements: 2})
+	assert.NoError(t, err)
+	defer queue.Delete()
+	writer := NewBatchWriter(queue, 0, time.Hour)
+
+	futures := []*PushFuture{writer.Push(MockData{1}), writer.Push(MockData{2}), writer.Push(MockData{3})}
+	assert.NoError(t, writer.Close())
+	assert.NoError(t, futures[0].Wait())
+	assert.NoError(t, futures[1].Wait())
+	assert.Same(t, ErrQueueFull, futures[2].Wait())
+	assert.Equal(t, int64(2), queue.Size())
+}
+
+func TestBatchWriter_CloseStopsWaitingForSpace(t *testing.T) {
+	queue, err := NewBoundedFileQueue("bounded-queue", &MockDataSerializer{},
+		Capacity{MaxElements: 1, Policy: OverflowBlock})
+	assert.NoError(t, err)
+	defer queue.Delete()
+	writer := NewBatchWriter(queue, 0, 0)
+
+	assert.NoError(t, writer.Push(MockData{1}).Wait())
+	blocked := writer.Push(MockData{2})
+	closed := make(chan error)
+	go func() {
+		closed <- writer.Close()
+	}()
+	select {
+	case err := <-closed:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close should not wait for space in the queue")
+	}
+	assert.Same(t, ErrBatchWriterClosed, blocked.Wait())
+	assert.Equal(t, int64(1), queue.Size())
+}
+
+func TestBatchWriter_CloseFlushesPending(t *testing.T) {
+	queue, err := NewStorageQueue(NewMemoryStorage(), &MockDataSerializer{})
+	assert.NoError(t, err)
+	writer := NewBatchWriter(queue, 0, time.Hour)
+
+	future := writer.Push(MockData{1})
+	assert.NoError(t, writer.Close())
+	select {
+	case <-future.Done():
+	default:
+		t.Fatal("the push should be completed by Close")
+	}
+	assert.NoError(t, future.Wait())
+	assert.Equal(t, int64(1), queue.Size())
+
+	assert.Same(t, ErrBatchWriterClosed, writer.Push(MockData{2}).Wait())
+}
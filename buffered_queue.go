@@ -0,0 +1,214 @@
+package eunomia
+
+import (
+	"bytes"
+	"context"
+	"sync"
+)
+
+// A Queue keeping the first elements in memory, and spilling to a FileQueue once the memory buffer is full.
+// As long as the consumers keep up with the producers, elements never touch the disk. Under load, the elements that
+// don't fit in the buffer are pushed to the FileQueue, and since new elements keep going to the disk until it's
+// drained, the global FIFO order is preserved.
+//
+// The buffered elements are lost if the process stops, unless the queue was created with flushOnClose and Close is
+// called, in which case they are written back to the head of the FileQueue.
+type BufferedQueue struct {
+	disk         *FileQueue
+	bufferSize   int
+	flushOnClose bool
+	// serialized elements kept in memory, they all come before the elements of the disk queue.
+	buffer [][]byte
+	mu     sync.Mutex
+}
+
+// Creates a queue buffering up to bufferSize elements in memory in front of the given FileQueue.
+// A bounded FileQueue is not buffered, every element goes through it's capacity checks and overflow policy.
+func NewBufferedQueue(disk *FileQueue, bufferSize int, flushOnClose bool) *BufferedQueue {
+	if capacity := disk.Capacity(); capacity.MaxElements > 0 || capacity.MaxBytes > 0 {
+		bufferSize = 0
+	}
+	return &BufferedQueue{
+		disk:         disk,
+		bufferSize:   bufferSize,
+		flushOnClose: flushOnClose,
+	}
+}
+
+func (b *BufferedQueue) Push(element interface{}) error {
+	data := b.disk.serializer.Write(element)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.disk.checkOpen(); err != nil {
+		return err
+	}
+	if len(b.buffer) < b.bufferSize && b.disk.Size() == 0 {
+		b.buffer = append(b.buffer, data)
+		return nil
+	}
+	return b.disk.pushData(context.Background(), data)
+}
+
+func (b *BufferedQueue) Poll() (interface{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.disk.checkOpen(); err != nil {
+		return nil, err
+	}
+	if len(b.buffer) == 0 {
+		return b.disk.Poll()
+	}
+	data := b.buffer[0]
+	b.buffer[0] = nil
+	b.buffer = b.buffer[1:]
+	return b.disk.serializer.Read(bytes.NewReader(data)), nil
+}
+
+func (b *BufferedQueue) Peek() (interface{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.disk.checkOpen(); err != nil {
+		return nil, err
+	}
+	if len(b.buffer) == 0 {
+		return b.disk.Peek()
+	}
+	return b.disk.serializer.Read(bytes.NewReader(b.buffer[0])), nil
+}
+
+func (b *BufferedQueue) Size() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int64(len(b.buffer)) + b.disk.Size()
+}
+
+func (b *BufferedQueue) elementSerializer() Serializer {
+	return b.disk.serializer
+}
+
+// Visits the buffered elements, then the elements of the disk queue, holding the lock of the buffered queue.
+func (b *BufferedQueue) rawElements(visit func(data []byte) bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.disk.checkOpen(); err != nil {
+		return err
+	}
+	for _, data := range b.buffer {
+		if !visit(data) {
+			return nil
+		}
+	}
+	return b.disk.rawElements(visit)
+}
+
+// Drops the buffered elements and deletes the disk queue.
+func (b *BufferedQueue) Delete() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buffer = nil
+	return b.disk.Delete()
+}
+
+// Writes the buffered elements to the head of the disk queue if the queue was created with flushOnClose,
+// otherwise they are dropped, and closes the disk queue.
+func (b *BufferedQueue) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.flushOnClose && len(b.buffer) > 0 {
+		if err := b.disk.prepend(b.buffer); err != nil {
+			return err
+		}
+	}
+	b.buffer = nil
+	return b.disk.Close()
+}
+
+// Inserts the serialized elements before the head of the queue, in the given order, or fails with ErrQueueFull if
+// they don't fit in the capacity of the queue.
+// The elements are written in the space left by the polled elements if it's big enough, otherwise the live elements
+// are moved further in the file to make room for them, see moveLiveElements, and the header is switched to the moved
+// elements before the new ones are written over the old copy. Either way, a crash leaves the existing elements
+// readable.
+func (f *FileQueue) prepend(elements [][]byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.writable(); err != nil {
+		return err
+	}
+	if f.codec != 0 {
+		encoded := make([][]byte, len(elements))
+		for i, data := range elements {
+			encoded[i] = f.encode(nil, data)
+		}
+		elements = encoded
+	}
+	current := f.writer.header
+	needed := int64(0)
+	for _, data := range elements {
+		needed += 8 + int64(len(data))
+	}
+	start := dataStart(current.flags)
+	liveEnd := f.liveEnd()
+	if current.maxElements > 0 && current.elementCount+int64(len(elements)) > current.maxElements {
+		return ErrQueueFull
+	}
+	if current.maxBytes > 0 && liveEnd-current.head.offset+needed > current.maxBytes {
+		return ErrQueueFull
+	}
+	f.ahead.invalidate()
+	f.moves++
+	updatedHeader := *current
+	liveStart := current.head.offset
+	if current.elementCount == 0 {
+		// nothing is live, the elements can be written from the start of the file.
+		liveStart = start + needed
+	} else if liveStart-start < needed {
+		if err := moveLiveElements(f.writer.backingFile, &updatedHeader, start, liveEnd, needed); err != nil {
+			return err
+		}
+		// the new elements overlap the old copy of the live elements, the header must point to the moved ones first.
+		if err := f.writer.backingFile.Sync(); err != nil {
+			return err
+		}
+		if err := writeHeader(f.writer.backingFile, &updatedHeader); err != nil {
+			return err
+		}
+		if err := f.writer.backingFile.Sync(); err != nil {
+			return err
+		}
+		moved := updatedHeader
+		f.writer.header = &moved
+		f.cursor = nil
+		liveStart = updatedHeader.head.offset
+	}
+	offset := liveStart - needed
+	for _, data := range elements {
+		if _, err := WriteLong(f.writer.backingFile, offset, int64(len(data))); err != nil {
+			return err
+		}
+		if _, err := WriteChunk(f.writer.backingFile, offset+8, data); err != nil {
+			return err
+		}
+		offset += 8 + int64(len(data))
+	}
+	updatedHeader.head = &elementPtr{
+		offset: liveStart - needed,
+		length: int64(len(elements[0])),
+		index:  current.head.index - int64(len(elements)),
+	}
+	if current.elementCount == 0 {
+		last := elements[len(elements)-1]
+		updatedHeader.tail = &elementPtr{
+			offset: liveStart - 8 - int64(len(last)),
+			length: int64(len(last)),
+			index:  current.head.index - 1,
+		}
+	}
+	updatedHeader.elementCount += int64(len(elements))
+	if err := writeHeader(f.writer.backingFile, &updatedHeader); err != nil {
+		return err
+	}
+	f.writer.header = &updatedHeader
+	f.cursor = nil
+	return f.sync()
+}
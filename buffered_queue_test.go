@@ -0,0 +1,169 @@
+package eunomia
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBufferedQueue_SpillsToDiskInOrder(t *testing.T) {
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		disk := open()
+		queue := NewBufferedQueue(disk, 3, false)
+
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, queue.Push(MockData{int32(i)}))
+		}
+		assert.Equal(t, int64(5), queue.Size())
+		assert.Equal(t, int64(2), disk.Size())
+
+		el, err := queue.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, MockData{0}, el)
+		// the disk queue is not empty, so this one goes after the spilled elements.
+		assert.NoError(t, queue.Push(MockData{5}))
+
+		for i := 1; i < 6; i++ {
+			el, err := queue.Peek()
+			assert.NoError(t, err)
+			assert.Equal(t, MockData{int32(i)}, el)
+			el, err = queue.Poll()
+			assert.NoError(t, err)
+			assert.Equal(t, MockData{int32(i)}, el)
+		}
+		_, err = queue.Poll()
+		assert.Same(t, EmptyQueueError, err)
+	})
+}
+
+func TestBufferedQueue_FlushOnClose(t *testing.T) {
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := NewBufferedQueue(open(), 2, true)
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, queue.Push(MockData{int32(i)}))
+		}
+		assert.NoError(t, queue.Close())
+
+		restored := open()
+		assert.Equal(t, int64(5), restored.Size())
+		for i := 0; i < 5; i++ {
+			el, err := restored.Poll()
+			assert.NoError(t, err)
+			assert.Equal(t, MockData{int32(i)}, el)
+		}
+	})
+}
+
+func TestBufferedQueue_FlushOnCloseReusesPolledSpace(t *testing.T) {
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		disk := open()
+		for i := 0; i < 4; i++ {
+			assert.NoError(t, disk.Push(MockData{int32(-1)}))
+		}
+		for i := 0; i < 4; i++ {
+			_, err := disk.Poll()
+			assert.NoError(t, err)
+		}
+		queue := NewBufferedQueue(disk, 2, true)
+		for i := 0; i < 4; i++ {
+			assert.NoError(t, queue.Push(MockData{int32(i)}))
+		}
+		_, err := disk.Poll()
+		assert.NoError(t, err)
+		assert.NoError(t, queue.Close())
+
+		restored := open()
+		for _, value := range []int32{0, 1, 3} {
+			el, err := restored.Poll()
+			assert.NoError(t, err)
+			assert.Equal(t, MockData{value}, el)
+		}
+		assert.Equal(t, int64(0), restored.Size())
+	})
+}
+
+func TestBufferedQueue_DropsBufferWithoutFlush(t *testing.T) {
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := NewBufferedQueue(open(), 2, false)
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, queue.Push(MockData{int32(i)}))
+		}
+		assert.NoError(t, queue.Close())
+
+		restored := open()
+		assert.Equal(t, int64(1), restored.Size())
+		el, err := restored.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, MockData{2}, el)
+	})
+}
+
+func TestBufferedQueue_BoundedDiskIsNotBuffered(t *testing.T) {
+	disk, err := NewBoundedFileQueue("buffered-queue", &MockDataSerializer{}, Capacity{MaxElements: 2})
+	assert.NoError(t, err)
+	defer disk.Delete()
+	queue := NewBufferedQueue(disk, 2, true)
+	assert.NoError(t, queue.Push(MockData{1}))
+	assert.NoError(t, queue.Push(MockData{2}))
+	assert.Equal(t, int64(2), disk.Size())
+	assert.Same(t, ErrQueueFull, queue.Push(MockData{3}))
+	assert.Equal(t, int64(2), queue.Size())
+}
+
+func TestFileQueue_PrependEnforcesCapacity(t *testing.T) {
+	queue, err := NewBoundedFileQueue("buffered-queue", &MockDataSerializer{}, Capacity{MaxElements: 3})
+	assert.NoError(t, err)
+	defer queue.Delete()
+	assert.NoError(t, queue.Push(MockData{2}))
+	assert.NoError(t, queue.Push(MockData{3}))
+	assert.Same(t, ErrQueueFull, queue.prepend([][]byte{{0, 0, 0, 0}, {0, 0, 0, 1}}))
+	assert.Equal(t, int64(2), queue.Size())
+	assert.NoError(t, queue.prepend([][]byte{{0, 0, 0, 1}}))
+	for i := int32(1); i <= 3; i++ {
+		el, err := queue.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, MockData{i}, el)
+	}
+}
+
+func TestFileQueue_PrependMovesLiveElements(t *testing.T) {
+	queue, err := OpenFileQueue("buffered-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer queue.Delete()
+	for i := int32(2); i < 10; i++ {
+		assert.NoError(t, queue.Push(MockData{i}))
+	}
+	assert.NoError(t, queue.prepend([][]byte{{0, 0, 0, 0}, {0, 0, 0, 1}}))
+	// the live elements are moved right after the free space left for the prepended ones and as many bytes as they
+	// take, not after their current end.
+	size, err := queue.writer.backingFile.Size()
+	assert.NoError(t, err)
+	assert.Equal(t, headerSize+2*12+2*8*12, size)
+	for i := int32(0); i < 10; i++ {
+		el, err := queue.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, MockData{i}, el)
+	}
+}
+
+func TestFileQueue_PrependSurvivesCrash(t *testing.T) {
+	storage := newCrashStorage()
+	queue, err := NewStorageQueue(storage, &MockDataSerializer{})
+	assert.NoError(t, err)
+	for i := int32(1); i < 10; i++ {
+		assert.NoError(t, queue.Push(MockData{i}))
+	}
+	// the free space before the head is too small, and the moved elements end after the start of the old copy.
+	_, err = queue.Poll()
+	assert.NoError(t, err)
+	storage.states = nil
+	assert.NoError(t, queue.prepend([][]byte{{0, 0, 0, 0}, {0, 0, 0, 1}}))
+
+	// a crash at any point leaves either the previous elements, or all of them.
+	for _, values := range storage.restoredValues(t) {
+		if len(values) == 8 {
+			assert.Equal(t, []int32{2, 3, 4, 5, 6, 7, 8, 9}, values)
+		} else {
+			assert.Equal(t, []int32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, values)
+		}
+	}
+}
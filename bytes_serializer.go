@@ -0,0 +1,23 @@
+package eunomia
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+// A Serializer for raw []byte elements, the data is written as is.
+type BytesSerializer struct {
+}
+
+func (b *BytesSerializer) Write(element interface{}) []byte {
+	return element.([]byte)
+}
+
+func (b *BytesSerializer) AppendTo(dst []byte, element interface{}) []byte {
+	return append(dst, element.([]byte)...)
+}
+
+func (b *BytesSerializer) Read(reader io.Reader) interface{} {
+	data, _ := ioutil.ReadAll(reader)
+	return data
+}
@@ -0,0 +1,20 @@
+package eunomia
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBytesSerializer(t *testing.T) {
+	forEachBackend(t, &BytesSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
+		assert.NoError(t, queue.Push([]byte("first")))
+		assert.NoError(t, queue.Push([]byte{}))
+		el, err := queue.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("first"), el)
+		el, err = queue.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{}, el)
+	})
+}
@@ -0,0 +1,120 @@
+package eunomia
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrQueueFull = errors.New("the queue has reached it's capacity")
+
+// Returned by appendFrame when the element is dropped by a full OverflowDropNewest queue, the pushes report it as a
+// success.
+var errDropped = errors.New("the element was dropped by a full queue")
+
+// What a bounded queue does when an element is pushed while it's full.
+type OverflowPolicy int
+
+const (
+	// The push fails with ErrQueueFull.
+	OverflowFail OverflowPolicy = iota
+	// The push waits until enough elements are polled, or until it's context is done.
+	OverflowBlock
+	// The oldest elements are dropped to make room for the new one.
+	OverflowDropOldest
+	// The new element is silently dropped.
+	OverflowDropNewest
+)
+
+// Capacity limits of a bounded queue, a limit set to 0 is not enforced.
+type Capacity struct {
+	// Maximum number of elements in the queue.
+	MaxElements int64
+	// Maximum number of bytes taken by the elements in the file, including the 8 bytes length of every element.
+	MaxBytes int64
+	// What to do when the queue is full.
+	Policy OverflowPolicy
+}
+
+// Creates or restores a bounded flat-file queue from the given file path, same as opening it with the WithCapacity
+// option.
+// The limits are persisted in the file header, so reopening the file without capacity keeps enforcing them (with the
+// OverflowFail policy), reopening it with a capacity replaces them with the given ones.
+// Since the limits are written in the header, a queue created without capacity cannot be reopened as a bounded queue.
+func NewBoundedFileQueue(filePath string, serializer Serializer, capacity Capacity) (*FileQueue, error) {
+	return OpenFileQueue(filePath, serializer, WithCapacity(capacity))
+}
+
+// Returns the capacity limits of the queue, and it's overflow policy.
+func (f *FileQueue) Capacity() Capacity {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return Capacity{
+		MaxElements: f.writer.header.maxElements,
+		MaxBytes:    f.writer.header.maxBytes,
+		Policy:      f.overflow,
+	}
+}
+
+// Makes sure an element of the given length can be pushed, according to the overflow policy.
+// Returns false if the element should be dropped, or an error if it cannot be pushed.
+// Must be called with the queue lock held, the lock is released while waiting for space.
+func (f *FileQueue) makeRoom(ctx context.Context, dataLength int64) (bool, error) {
+	header := f.writer.header
+	if header.maxBytes > 0 && dataLength+8 > header.maxBytes {
+		// the element would not fit even in an empty queue.
+		return false, ErrQueueFull
+	}
+	for !f.fits(dataLength) {
+		switch f.overflow {
+		case OverflowDropNewest:
+			return false, nil
+		case OverflowDropOldest:
+			if err := f.removeHead(); err != nil {
+				return false, err
+			}
+		case OverflowBlock:
+			if f.space == nil {
+				f.space = make(chan struct{})
+			}
+			space := f.space
+			f.mu.Unlock()
+			if f.blocked != nil {
+				f.blocked()
+			}
+			select {
+			case <-space:
+				f.mu.Lock()
+				if err := f.writer.checkOpen(); err != nil {
+					return false, err
+				}
+			case <-ctx.Done():
+				f.mu.Lock()
+				return false, ctx.Err()
+			}
+		default:
+			return false, ErrQueueFull
+		}
+	}
+	return true, nil
+}
+
+// Returns true if an element of the given length can be pushed without exceeding the capacity of the queue.
+func (f *FileQueue) fits(dataLength int64) bool {
+	header := f.writer.header
+	if header.elementCount == 0 {
+		return true
+	}
+	if header.maxElements > 0 && header.elementCount >= header.maxElements {
+		return false
+	}
+	used := header.tail.offset + 8 + header.tail.length - header.head.offset
+	return header.maxBytes <= 0 || used+dataLength+8 <= header.maxBytes
+}
+
+// Wakes up the pushes waiting for space in the queue.
+func (f *FileQueue) signalSpace() {
+	if f.space != nil {
+		close(f.space)
+		f.space = nil
+	}
+}
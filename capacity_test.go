@@ -0,0 +1,135 @@
+package eunomia
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBoundedFileQueue_Fail(t *testing.T) {
+	queue, err := NewBoundedFileQueue("bounded-queue", &MockDataSerializer{}, Capacity{MaxElements: 2})
+	assert.NoError(t, err)
+	defer queue.Delete()
+
+	assert.NoError(t, queue.Push(MockData{1}))
+	assert.NoError(t, queue.Push(MockData{2}))
+	assert.Same(t, ErrQueueFull, queue.Push(MockData{3}))
+
+	_, err = queue.Poll()
+	assert.NoError(t, err)
+	assert.NoError(t, queue.Push(MockData{3}))
+	assert.Equal(t, int64(2), queue.Size())
+}
+
+func TestBoundedFileQueue_MaxBytes(t *testing.T) {
+	// every element takes 12 bytes.
+	queue, err := NewBoundedFileQueue("bounded-queue", &MockDataSerializer{}, Capacity{MaxBytes: 30})
+	assert.NoError(t, err)
+	defer queue.Delete()
+
+	assert.NoError(t, queue.Push(MockData{1}))
+	assert.NoError(t, queue.Push(MockData{2}))
+	assert.Same(t, ErrQueueFull, queue.Push(MockData{3}))
+
+	tooSmall, err := NewBoundedFileQueue("bounded-queue", &MockDataSerializer{}, Capacity{MaxBytes: 10})
+	assert.NoError(t, err)
+	_, err = tooSmall.Poll()
+	assert.NoError(t, err)
+	assert.Same(t, ErrQueueFull, tooSmall.Push(MockData{3}))
+}
+
+func TestBoundedFileQueue_DropPolicies(t *testing.T) {
+	queue, err := NewBoundedFileQueue("bounded-queue", &MockDataSerializer{}, Capacity{MaxElements: 2, Policy: OverflowDropOldest})
+	assert.NoError(t, err)
+	defer queue.Delete()
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, queue.Push(MockData{int32(i)}))
+	}
+	assert.Equal(t, int64(2), queue.Size())
+	el, err := queue.Peek()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), el.(MockData).value)
+
+	dropNewest, err := NewBoundedFileQueue("bounded-queue", &MockDataSerializer{}, Capacity{MaxElements: 2, Policy: OverflowDropNewest})
+	assert.NoError(t, err)
+	assert.NoError(t, dropNewest.Push(MockData{5}))
+	assert.Equal(t, int64(2), dropNewest.Size())
+	el, err = dropNewest.Peek()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), el.(MockData).value)
+}
+
+func TestBoundedFileQueue_Block(t *testing.T) {
+	queue, err := NewBoundedFileQueue("bounded-queue", &MockDataSerializer{}, Capacity{MaxElements: 1, Policy: OverflowBlock})
+	assert.NoError(t, err)
+	defer queue.Delete()
+
+	assert.NoError(t, queue.Push(MockData{1}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, queue.PushContext(ctx, MockData{2}))
+
+	blocked := make(chan struct{})
+	queue.blocked = func() { close(blocked) }
+	pushed := make(chan error)
+	go func() {
+		pushed <- queue.Push(MockData{2})
+	}()
+	<-blocked
+	el, err := queue.Poll()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), el.(MockData).value)
+	assert.NoError(t, <-pushed)
+
+	el, err = queue.Poll()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), el.(MockData).value)
+}
+
+func TestBoundedFileQueue_CapacityIsPersisted(t *testing.T) {
+	queue, err := NewBoundedFileQueue("bounded-queue", &MockDataSerializer{}, Capacity{MaxElements: 1, MaxBytes: 100})
+	assert.NoError(t, err)
+	defer queue.Delete()
+	assert.NoError(t, queue.Push(MockData{1}))
+
+	restored, err := NewFileQueue("bounded-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	fq := restored.(*FileQueue)
+	assert.Equal(t, Capacity{MaxElements: 1, MaxBytes: 100, Policy: OverflowFail}, fq.Capacity())
+	assert.Equal(t, int64(64), fq.writer.header.head.offset)
+	assert.Same(t, ErrQueueFull, restored.Push(MockData{2}))
+}
+
+func TestBoundedFileQueue_RejectsUnboundedFile(t *testing.T) {
+	queue, err := NewFileQueue("some-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer queue.Delete()
+
+	_, err = NewBoundedFileQueue("some-queue", &MockDataSerializer{}, Capacity{MaxElements: 1})
+	assert.Same(t, ErrIncompatibleFlags, err)
+}
+
+func TestBoundedFileQueue_CloseWakesBlockedPushes(t *testing.T) {
+	queue, err := NewBoundedFileQueue("bounded-queue", &MockDataSerializer{}, Capacity{MaxElements: 1, Policy: OverflowBlock})
+	assert.NoError(t, err)
+	defer queue.Delete()
+	assert.NoError(t, queue.Push(MockData{1}))
+
+	blocked := make(chan struct{})
+	queue.blocked = func() { close(blocked) }
+	done := make(chan error)
+	go func() {
+		done <- queue.Push(MockData{2})
+	}()
+	<-blocked
+	assert.NoError(t, queue.Close())
+	select {
+	case err := <-done:
+		assert.Same(t, ErrQueueClosed, err)
+	case <-time.After(time.Second):
+		t.Fatal("the blocked push was not woken up by Close")
+	}
+}
@@ -0,0 +1,413 @@
+// Command eunomia inspects and operates on queue files.
+//
+// Usage:
+//
+//	eunomia <command> [flags] <queue-file>
+//
+// The commands are:
+//
+//	info      print the header of the queue, and how much of the file is wasted
+//	dump      print every element of the queue
+//	peek      print the head of the queue
+//	poll      remove and print the head of the queue
+//	push      push the standard input to the queue
+//	verify    check the structure of the queue file, and optionally repair it
+//	compact   reclaim the space left by the polled elements
+//	purge     remove every element of the queue
+//	export    write the elements of the queue to the standard output, as JSON Lines or as a binary stream
+//	import    push the elements of an export read from the standard input
+//
+// The elements are handled as raw bytes. A queue file found with a torn tail is not recovered automatically, run
+// verify with -repair to drop the elements that were not fully written.
+// Every command works on the files of a FileQueue, info and verify also support the deque, stack and log files.
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chrmehdi/eunomia"
+)
+
+type command func(args []string, stdin io.Reader, stdout io.Writer) error
+
+var commands = map[string]command{
+	"info":    info,
+	"dump":    dump,
+	"peek":    peek,
+	"poll":    poll,
+	"push":    push,
+	"verify":  verify,
+	"compact": compact,
+	"purge":   purge,
+	"export":  export,
+	"import":  importElements,
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "eunomia:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return usage()
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return usage()
+	}
+	return cmd(args[1:], stdin, stdout)
+}
+
+func usage() error {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("usage: eunomia <%s> [flags] <queue-file>", strings.Join(names, "|"))
+}
+
+// Parses the flags of a command, and returns it's only argument, the path of the queue file.
+func parse(flags *flag.FlagSet, args []string) (string, error) {
+	if err := flags.Parse(args); err != nil {
+		return "", err
+	}
+	if flags.NArg() != 1 {
+		return "", fmt.Errorf("usage: eunomia %s [flags] <queue-file>", flags.Name())
+	}
+	return flags.Arg(0), nil
+}
+
+// Opens the queue of raw elements, a torn tail is reported instead of being recovered.
+func open(path string, opts ...eunomia.Option) (*eunomia.FileQueue, error) {
+	opts = append(opts, eunomia.WithRecovery(eunomia.RecoverStrict))
+	queue, err := eunomia.OpenFileQueue(path, &eunomia.BytesSerializer{}, opts...)
+	if err != eunomia.ErrIncompatibleFlags {
+		return queue, err
+	}
+	if info, infoErr := eunomia.ReadInfo(path); infoErr == nil {
+		switch {
+		case info.Flags&eunomia.FlagTrailingLength != 0:
+			return nil, fmt.Errorf("%s is a deque or stack file, only info and verify support it", path)
+		case info.Flags&eunomia.FlagLog != 0:
+			return nil, fmt.Errorf("%s is a log file, only info and verify support it", path)
+		}
+	}
+	return nil, err
+}
+
+// Formats the elements in one of the supported formats.
+type formatter func(data []byte) (string, error)
+
+var formatters = map[string]formatter{
+	"string": func(data []byte) (string, error) {
+		return string(data), nil
+	},
+	"hex": func(data []byte) (string, error) {
+		return hex.EncodeToString(data), nil
+	},
+	// the elements that are valid JSON are printed as is, the other ones as JSON strings.
+	"json": func(data []byte) (string, error) {
+		if json.Valid(data) {
+			return string(data), nil
+		}
+		encoded, err := json.Marshal(string(data))
+		return string(encoded), err
+	},
+}
+
+func formatFlag(flags *flag.FlagSet) *string {
+	return flags.String("format", "string", "format of the printed elements: string, hex or json")
+}
+
+func printElement(stdout io.Writer, format string, element interface{}) error {
+	formatter, ok := formatters[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q", format)
+	}
+	formatted, err := formatter(element.([]byte))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, formatted)
+	return err
+}
+
+func info(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("info", flag.ContinueOnError)
+	path, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	info, err := eunomia.ReadInfo(path)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "version\t0x%x\n", info.Version)
+	fmt.Fprintf(w, "flags\t0x%x%s\n", info.Flags, flagNames(info.Flags))
+	fmt.Fprintf(w, "elements\t%d\n", info.Size)
+	fmt.Fprintf(w, "head offset\t%d\n", info.HeadOffset)
+	fmt.Fprintf(w, "tail offset\t%d\n", info.TailOffset)
+	fmt.Fprintf(w, "file size\t%d\n", info.FileSize)
+	fmt.Fprintf(w, "live bytes\t%d\n", info.Bytes)
+	fmt.Fprintf(w, "wasted bytes\t%d\n", info.WastedBytes)
+	if info.Flags&eunomia.FlagBounded != 0 {
+		fmt.Fprintf(w, "max elements\t%d\n", info.MaxElements)
+		fmt.Fprintf(w, "max bytes\t%d\n", info.MaxBytes)
+	}
+	fmt.Fprintf(w, "created at\t%s\n", formatTime(info.CreatedAt))
+	fmt.Fprintf(w, "updated at\t%s\n", formatTime(info.UpdatedAt))
+	return w.Flush()
+}
+
+func flagNames(flags int32) string {
+	names := make([]string, 0)
+	if flags&eunomia.FlagTrailingLength != 0 {
+		names = append(names, "trailing-length")
+	}
+	if flags&eunomia.FlagLog != 0 {
+		names = append(names, "log")
+	}
+	if flags&eunomia.FlagBounded != 0 {
+		names = append(names, "bounded")
+	}
+	if flags&eunomia.FlagChecksum != 0 {
+		names = append(names, "checksum")
+	}
+	if flags&eunomia.FlagCompressed != 0 {
+		names = append(names, "compressed")
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(names, ", ") + ")"
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func dump(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("dump", flag.ContinueOnError)
+	format := formatFlag(flags)
+	path, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	queue, err := open(path, eunomia.WithReadOnly())
+	if err != nil {
+		return err
+	}
+	defer queue.Close()
+	it := queue.SnapshotIterator()
+	for it.Next() {
+		if err := printElement(stdout, *format, it.Value()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+func peek(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("peek", flag.ContinueOnError)
+	format := formatFlag(flags)
+	path, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	queue, err := open(path, eunomia.WithReadOnly())
+	if err != nil {
+		return err
+	}
+	defer queue.Close()
+	element, err := queue.Peek()
+	if err != nil {
+		return err
+	}
+	return printElement(stdout, *format, element)
+}
+
+func poll(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("poll", flag.ContinueOnError)
+	format := formatFlag(flags)
+	count := flags.Int("n", 1, "number of elements to poll")
+	path, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	queue, err := open(path, eunomia.WithMustExist())
+	if err != nil {
+		return err
+	}
+	defer queue.Close()
+	for i := 0; i < *count; i++ {
+		element, err := queue.Poll()
+		if err == eunomia.EmptyQueueError && i > 0 {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := printElement(stdout, *format, element); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func push(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("push", flag.ContinueOnError)
+	lines := flags.Bool("lines", false, "push every line of the standard input as an element, instead of the whole input")
+	path, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	queue, err := open(path)
+	if err != nil {
+		return err
+	}
+	defer queue.Close()
+	if !*lines {
+		data, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		return queue.Push(data)
+	}
+	scanner := bufio.NewScanner(stdin)
+	for scanner.Scan() {
+		if err := queue.Push(append([]byte(nil), scanner.Bytes()...)); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func verify(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	repair := flags.Bool("repair", false, "drop the elements after the last valid one if the file is not valid")
+	path, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	var report *eunomia.VerifyReport
+	if *repair {
+		report, err = eunomia.Repair(path)
+	} else {
+		report, err = eunomia.Verify(path)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%d valid elements out of %d\n", report.ValidCount, report.DeclaredCount)
+	for _, problem := range report.Problems {
+		fmt.Fprintln(stdout, "problem:", problem)
+	}
+	if report.Repaired {
+		fmt.Fprintf(stdout, "repaired: dropped %d elements and truncated %d bytes\n", report.DroppedCount, report.TruncatedBytes)
+		return nil
+	}
+	if !report.Valid() {
+		return errors.New("the queue file is not valid")
+	}
+	return nil
+}
+
+func compact(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("compact", flag.ContinueOnError)
+	path, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	queue, err := open(path, eunomia.WithMustExist())
+	if err != nil {
+		return err
+	}
+	defer queue.Close()
+	reclaimed, err := queue.Compact()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "reclaimed %d bytes\n", reclaimed)
+	return err
+}
+
+func purge(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("purge", flag.ContinueOnError)
+	path, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	queue, err := open(path, eunomia.WithMustExist())
+	if err != nil {
+		return err
+	}
+	defer queue.Close()
+	size := queue.Size()
+	if err := queue.Purge(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "purged %d elements\n", size)
+	return err
+}
+
+func export(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", "jsonl", "format of the export: jsonl or binary")
+	path, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	exportFormat := eunomia.FormatJSONL
+	switch *format {
+	case "jsonl":
+	case "binary":
+		exportFormat = eunomia.FormatBinary
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	queue, err := open(path, eunomia.WithReadOnly())
+	if err != nil {
+		return err
+	}
+	defer queue.Close()
+	return eunomia.Export(queue, stdout, exportFormat)
+}
+
+func importElements(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	path, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	queue, err := open(path)
+	if err != nil {
+		return err
+	}
+	defer queue.Close()
+	imported, err := eunomia.Import(stdin, queue)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "imported %d elements\n", imported)
+	return err
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/chrmehdi/eunomia"
+	"github.com/stretchr/testify/assert"
+)
+
+func runCommand(t *testing.T, stdin string, args ...string) (string, error) {
+	var stdout bytes.Buffer
+	err := run(args, strings.NewReader(stdin), &stdout)
+	return stdout.String(), err
+}
+
+func TestRun_PushDumpPoll(t *testing.T) {
+	path := "cli-queue"
+	defer os.Remove(path)
+
+	_, err := runCommand(t, "first\nsecond\n{\"third\":3}\n", "push", "-lines", path)
+	assert.NoError(t, err)
+	_, err = runCommand(t, "whole\ninput", "push", path)
+	assert.NoError(t, err)
+
+	out, err := runCommand(t, "", "dump", path)
+	assert.NoError(t, err)
+	assert.Equal(t, "first\nsecond\n{\"third\":3}\nwhole\ninput\n", out)
+
+	out, err = runCommand(t, "", "dump", "-format", "json", path)
+	assert.NoError(t, err)
+	assert.Equal(t, "\"first\"\n\"second\"\n{\"third\":3}\n\"whole\\ninput\"\n", out)
+
+	out, err = runCommand(t, "", "peek", "-format", "hex", path)
+	assert.NoError(t, err)
+	assert.Equal(t, "6669727374\n", out)
+
+	out, err = runCommand(t, "", "poll", "-n", "2", path)
+	assert.NoError(t, err)
+	assert.Equal(t, "first\nsecond\n", out)
+
+	out, err = runCommand(t, "", "info", path)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "version       0x24\n")
+	assert.Contains(t, out, "elements      2\n")
+	assert.Contains(t, out, "wasted bytes  27\n")
+
+	out, err = runCommand(t, "", "compact", path)
+	assert.NoError(t, err)
+	assert.Equal(t, "reclaimed 27 bytes\n", out)
+
+	out, err = runCommand(t, "", "purge", path)
+	assert.NoError(t, err)
+	assert.Equal(t, "purged 2 elements\n", out)
+	_, err = runCommand(t, "", "peek", path)
+	assert.Error(t, err)
+}
+
+func TestRun_ExportImport(t *testing.T) {
+	path, copyPath := "cli-export-queue", "cli-import-queue"
+	defer os.Remove(path)
+	defer os.Remove(copyPath)
+	_, err := runCommand(t, "a\nb\n", "push", "-lines", path)
+	assert.NoError(t, err)
+
+	out, err := runCommand(t, "", "export", path)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"index\":0,\"data\":\"YQ==\"}\n{\"index\":1,\"data\":\"Yg==\"}\n", out)
+
+	binary, err := runCommand(t, "", "export", "-format", "binary", path)
+	assert.NoError(t, err)
+	out, err = runCommand(t, binary, "import", copyPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "imported 2 elements\n", out)
+	out, err = runCommand(t, "", "dump", copyPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "a\nb\n", out)
+}
+
+func TestRun_Verify(t *testing.T) {
+	path := "cli-verify-queue"
+	defer os.Remove(path)
+	_, err := runCommand(t, "a\nb\n", "push", "-lines", path)
+	assert.NoError(t, err)
+
+	out, err := runCommand(t, "", "verify", path)
+	assert.NoError(t, err)
+	assert.Equal(t, "2 valid elements out of 2\n", out)
+
+	// cut the last element.
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Truncate(path, info.Size()-1))
+
+	out, err = runCommand(t, "", "verify", path)
+	assert.Error(t, err)
+	assert.Contains(t, out, "problem:")
+	_, err = runCommand(t, "", "dump", path)
+	assert.Error(t, err)
+
+	out, err = runCommand(t, "", "verify", "-repair", path)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "repaired: dropped 1 elements")
+	out, err = runCommand(t, "", "dump", path)
+	assert.NoError(t, err)
+	assert.Equal(t, "a\n", out)
+}
+
+func TestRun_Errors(t *testing.T) {
+	_, err := runCommand(t, "")
+	assert.Error(t, err)
+	_, err = runCommand(t, "", "unknown", "queue")
+	assert.Error(t, err)
+	_, err = runCommand(t, "", "peek")
+	assert.Error(t, err)
+
+	// inspecting a missing file does not create it.
+	_, err = runCommand(t, "", "info", "missing-queue")
+	assert.Error(t, err)
+	_, err = os.Stat("missing-queue")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRun_InfoOnDequeAndLog(t *testing.T) {
+	deque, err := eunomia.NewFileDeque("cli-deque", &eunomia.BytesSerializer{})
+	assert.NoError(t, err)
+	defer deque.Delete()
+	assert.NoError(t, deque.PushBack([]byte("back")))
+
+	out, err := runCommand(t, "", "info", "cli-deque")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "flags         0x1 (trailing-length)\n")
+	assert.Contains(t, out, "elements      1\n")
+	assert.Contains(t, out, "live bytes    20\n")
+	_, err = runCommand(t, "", "dump", "cli-deque")
+	assert.EqualError(t, err, "cli-deque is a deque or stack file, only info and verify support it")
+
+	log, err := eunomia.NewFileLog("cli-log", &eunomia.BytesSerializer{}, eunomia.Retention{})
+	assert.NoError(t, err)
+	defer log.Delete()
+	assert.NoError(t, log.Append([]byte("entry")))
+
+	out, err = runCommand(t, "", "info", "cli-log")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "flags         0x2 (log)\n")
+	_, err = runCommand(t, "", "peek", "cli-log")
+	assert.EqualError(t, err, "cli-log is a log file, only info and verify support it")
+}
@@ -0,0 +1,62 @@
+package eunomia
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+)
+
+var ErrChecksumMismatch = errors.New("the checksum of the element does not match it's data")
+
+// Flags changing how the serialized elements are stored, the framing of the elements stays [length, data], only the
+// data is transformed.
+const codecFlags = FlagChecksum | FlagCompressed
+
+// Appends the stored form of the serialized element to dst: the data is compressed if the queue has the
+// FlagCompressed flag, and prefixed by it's 4 bytes CRC32 if it has the FlagChecksum flag.
+// Without these flags the data is stored as is.
+func (f *FileQueue) encode(dst, data []byte) []byte {
+	if f.codec&FlagCompressed != 0 {
+		data = compress(data, f.compressionLevel)
+	}
+	if f.codec&FlagChecksum != 0 {
+		dst = append(dst, 0, 0, 0, 0)
+		putInt(dst[len(dst)-4:], int32(crc32.ChecksumIEEE(data)))
+	}
+	return append(dst, data...)
+}
+
+// Returns the serialized element from it's stored form, see encode.
+// Without checksum and compression, the returned slice is the given one.
+func (f *FileQueue) decode(stored []byte) ([]byte, error) {
+	data := stored
+	if f.codec&FlagChecksum != 0 {
+		if !validChecksum(data) {
+			return nil, ErrChecksumMismatch
+		}
+		data = data[4:]
+	}
+	if f.codec&FlagCompressed != 0 {
+		return ioutil.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	}
+	return data, nil
+}
+
+// Returns true if the data starts with the CRC32 of the rest of the data.
+func validChecksum(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	return getInt(data) == int32(crc32.ChecksumIEEE(data[4:]))
+}
+
+func compress(data []byte, level int) []byte {
+	var buffer bytes.Buffer
+	// the level is checked when the queue is opened.
+	writer, _ := flate.NewWriter(&buffer, level)
+	writer.Write(data)
+	writer.Close()
+	return buffer.Bytes()
+}
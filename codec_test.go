@@ -0,0 +1,98 @@
+package eunomia
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodec_ChecksumsAndCompression(t *testing.T) {
+	for _, opts := range [][]Option{
+		{WithChecksums()},
+		{WithCompression(flate.BestSpeed)},
+		{WithChecksums(), WithCompression(flate.DefaultCompression)},
+	} {
+		queue, err := NewStorageQueue(NewMemoryStorage(), &BytesSerializer{}, opts...)
+		assert.NoError(t, err)
+		element := bytes.Repeat([]byte("eunomia "), 100)
+		assert.NoError(t, queue.Push(element))
+		assert.Equal(t, []error{nil, nil}, queue.pushBatch(context.Background(), [][]byte{[]byte("a"), []byte("b")}))
+		assert.NoError(t, queue.prepend([][]byte{[]byte("first")}))
+		_, err = queue.ReplaceIf(func(el interface{}) bool {
+			return string(el.([]byte)) == "a"
+		}, func(interface{}) interface{} {
+			return []byte("c")
+		})
+		assert.NoError(t, err)
+
+		var out bytes.Buffer
+		assert.NoError(t, Export(queue, &out, FormatBinary))
+		for _, expected := range [][]byte{[]byte("first"), element, []byte("c"), []byte("b")} {
+			el, err := queue.Poll()
+			assert.NoError(t, err)
+			assert.Equal(t, expected, el)
+		}
+		imported, err := Import(&out, queue)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4), imported)
+		el, err := queue.Get(1)
+		assert.NoError(t, err)
+		assert.Equal(t, element, el)
+	}
+}
+
+func TestCodec_CompressionShrinksElements(t *testing.T) {
+	queue, err := NewStorageQueue(NewMemoryStorage(), &BytesSerializer{}, WithCompression(flate.BestCompression))
+	assert.NoError(t, err)
+	assert.NoError(t, queue.Push(bytes.Repeat([]byte("a"), 1000)))
+	info, err := queue.Info()
+	assert.NoError(t, err)
+	assert.True(t, info.Bytes < 100)
+
+	_, err = NewStorageQueue(NewMemoryStorage(), &BytesSerializer{}, WithCompression(42))
+	assert.Error(t, err)
+}
+
+func TestCodec_ChecksumMismatch(t *testing.T) {
+	defer os.Remove("checksum-queue")
+	queue, err := OpenFileQueue("checksum-queue", &MockDataSerializer{}, WithChecksums())
+	assert.NoError(t, err)
+	assert.NoError(t, queue.Push(MockData{1}))
+	assert.NoError(t, queue.Push(MockData{2}))
+	assert.NoError(t, queue.Close())
+
+	// every element takes 16 bytes, corrupt the last byte of the data of the second one.
+	file, err := os.OpenFile("checksum-queue", os.O_RDWR, 0)
+	assert.NoError(t, err)
+	_, err = file.WriteAt([]byte{0xff}, headerSize+16+8+4+3)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	report, err := Verify("checksum-queue")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"the element at offset 64 does not match it's checksum"}, report.Problems)
+
+	// the checksums are kept without the option.
+	queue, err = OpenFileQueue("checksum-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer queue.Close()
+	el, err := queue.Poll()
+	assert.NoError(t, err)
+	assert.Equal(t, MockData{1}, el)
+	_, err = queue.Poll()
+	assert.Same(t, ErrChecksumMismatch, err)
+}
+
+func TestCodec_FlagsCannotBeAdded(t *testing.T) {
+	storage := NewMemoryStorage()
+	_, err := NewStorageQueue(storage, &MockDataSerializer{})
+	assert.NoError(t, err)
+	_, err = NewStorageQueue(storage, &MockDataSerializer{}, WithChecksums())
+	assert.Same(t, ErrIncompatibleFlags, err)
+	_, err = NewStorageQueue(storage, &MockDataSerializer{}, WithCompression(flate.DefaultCompression))
+	assert.Same(t, ErrIncompatibleFlags, err)
+}
@@ -0,0 +1,121 @@
+package eunomia
+
+// Moves the live elements to the start of the file, and truncates the file after them, to reclaim the space left by
+// the polled elements. Returns the number of bytes the file was shrunk by.
+//
+// The live elements are never overwritten before the header points to another copy of them, so a crash leaves the queue
+// readable. The iterators created before compacting start over from the head.
+func (f *FileQueue) Compact() (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.writable(); err != nil {
+		return 0, err
+	}
+	return f.compact()
+}
+
+// Same as Compact, for the callers already holding the lock.
+func (f *FileQueue) compact() (int64, error) {
+	size, err := f.writer.backingFile.Size()
+	if err != nil {
+		return 0, err
+	}
+	current := f.writer.header
+	start := dataStart(current.flags)
+	shift := current.head.offset - start
+	liveEnd := f.liveEnd()
+	if shift > 0 && shift < liveEnd-current.head.offset {
+		// the copy at the start of the file would overwrite the live elements, they are first moved past their end.
+		staged := *current
+		if err := moveLiveElements(f.writer.backingFile, &staged, start, liveEnd, shift); err != nil {
+			return 0, err
+		}
+		if err := f.switchHeader(&staged); err != nil {
+			return 0, err
+		}
+		current = f.writer.header
+		shift = current.head.offset - start
+		liveEnd = f.liveEnd()
+	}
+	if shift > 0 {
+		if current.elementCount > 0 {
+			live, err := ReadChunk(f.writer.backingFile, current.head.offset, liveEnd-current.head.offset)
+			if err != nil {
+				return 0, err
+			}
+			f.ahead.invalidate()
+			if _, err := WriteChunk(f.writer.backingFile, start, live); err != nil {
+				return 0, err
+			}
+		}
+		updatedHeader := *current
+		// the new indexes start after the old tail, so that the existing iterators see the old elements as polled.
+		updatedHeader.head = &elementPtr{
+			offset: start,
+			length: current.head.length,
+			index:  current.tail.index + 1,
+		}
+		updatedHeader.tail = &elementPtr{
+			offset: current.tail.offset - shift,
+			length: current.tail.length,
+			index:  current.tail.index + current.elementCount,
+		}
+		if current.elementCount == 0 {
+			updatedHeader.head.index = current.head.index
+			updatedHeader.tail = &elementPtr{offset: start, index: current.head.index}
+		}
+		// the header is synced before the old copy is truncated.
+		if err := f.switchHeader(&updatedHeader); err != nil {
+			return 0, err
+		}
+		liveEnd -= shift
+	}
+	if liveEnd < size {
+		if err := f.writer.backingFile.Truncate(liveEnd); err != nil {
+			return 0, err
+		}
+	}
+	return size - liveEnd, f.sync()
+}
+
+// Syncs the elements written so far, and writes the given header pointing to them.
+func (f *FileQueue) switchHeader(updatedHeader *header) error {
+	if err := f.writer.backingFile.Sync(); err != nil {
+		return err
+	}
+	f.ahead.invalidate()
+	f.moves++
+	f.cursor = nil
+	if err := writeHeader(f.writer.backingFile, updatedHeader); err != nil {
+		return err
+	}
+	f.writer.header = updatedHeader
+	return f.writer.backingFile.Sync()
+}
+
+// Removes every element of the queue, and truncates the file after it's header.
+func (f *FileQueue) Purge() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.writable(); err != nil {
+		return err
+	}
+	current := f.writer.header
+	start := dataStart(current.flags)
+	updatedHeader := *current
+	updatedHeader.elementCount = 0
+	updatedHeader.head = &elementPtr{offset: start, index: current.tail.index + 1}
+	updatedHeader.tail = &elementPtr{offset: start, index: current.tail.index + 1}
+	if err := writeHeader(f.writer.backingFile, &updatedHeader); err != nil {
+		return err
+	}
+	f.writer.header = &updatedHeader
+	f.moves++
+	f.cursor = nil
+	f.ahead.invalidate()
+	f.signalSpace()
+	if err := f.writer.backingFile.Truncate(start); err != nil {
+		return err
+	}
+	return f.sync()
+}
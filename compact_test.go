@@ -0,0 +1,97 @@
+package eunomia
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFileQueue_Compact(t *testing.T) {
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, queue.Push(MockData{int32(i)}))
+		}
+		for i := 0; i < 6; i++ {
+			_, err := queue.Poll()
+			assert.NoError(t, err)
+		}
+		it := queue.Iterator()
+
+		reclaimed, err := queue.Compact()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(72), reclaimed)
+		info, err := queue.Info()
+		assert.NoError(t, err)
+		assert.Equal(t, headerSize, info.HeadOffset)
+		assert.Equal(t, int64(0), info.WastedBytes)
+
+		assert.NoError(t, queue.Push(MockData{10}))
+		values := make([]int32, 0)
+		for it.Next() {
+			values = append(values, it.Value().(MockData).value)
+		}
+		assert.NoError(t, it.Err())
+		assert.Equal(t, []int32{6, 7, 8, 9, 10}, values)
+
+		restored := open()
+		for i := int32(6); i <= 10; i++ {
+			el, err := restored.Poll()
+			assert.NoError(t, err)
+			assert.Equal(t, MockData{i}, el)
+		}
+
+		reclaimed, err = restored.Compact()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(60), reclaimed)
+		assert.NoError(t, restored.Push(MockData{11}))
+		el, err := restored.Peek()
+		assert.NoError(t, err)
+		assert.Equal(t, MockData{11}, el)
+	})
+}
+
+func TestFileQueue_CompactSurvivesCrash(t *testing.T) {
+	storage := newCrashStorage()
+	queue, err := NewStorageQueue(storage, &MockDataSerializer{})
+	assert.NoError(t, err)
+	for i := int32(0); i < 10; i++ {
+		assert.NoError(t, queue.Push(MockData{i}))
+	}
+	// the polled space is smaller than the live elements.
+	for i := 0; i < 3; i++ {
+		_, err := queue.Poll()
+		assert.NoError(t, err)
+	}
+	storage.states = nil
+	reclaimed, err := queue.Compact()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(36), reclaimed)
+	info, err := queue.Info()
+	assert.NoError(t, err)
+	assert.Equal(t, headerSize, info.HeadOffset)
+	assert.Equal(t, int64(0), info.WastedBytes)
+
+	for _, values := range storage.restoredValues(t) {
+		assert.Equal(t, []int32{3, 4, 5, 6, 7, 8, 9}, values)
+	}
+}
+
+func TestFileQueue_Purge(t *testing.T) {
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, queue.Push(MockData{int32(i)}))
+		}
+		assert.NoError(t, queue.Purge())
+		assert.Equal(t, int64(0), queue.Size())
+		_, err := queue.Peek()
+		assert.Same(t, EmptyQueueError, err)
+
+		assert.NoError(t, queue.Push(MockData{5}))
+		restored := open()
+		assert.Equal(t, int64(1), restored.Size())
+		el, err := restored.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, MockData{5}, el)
+	})
+}
@@ -0,0 +1,294 @@
+package eunomia
+
+import (
+	"bytes"
+	"os"
+)
+
+// A double ended queue backed by a flat file.
+// It uses the same file format as the FileQueue, but every element is framed as [length, data, length], the trailing
+// length allows to find the previous element of any element, which makes it possible to poll from the tail.
+// The file header has the FlagTrailingLength flag set, which means that a deque file cannot be opened as a FileQueue.
+//
+// Elements pushed to the front are written in the free space before the head, if there is not enough free space,
+// the live elements are moved further in the file to make room for them.
+type FileDeque struct {
+	filePath   string
+	writer     *QueueProtocolWriter
+	serializer Serializer
+}
+
+// Creates or restores a deque from the given file path.
+func NewFileDeque(filePath string, serializer Serializer) (*FileDeque, error) {
+	file, err := OpenFileStorage(filePath)
+	if err != nil {
+		return nil, err
+	}
+	protoWriter, err := newQueueWriterWithFlags(file, FlagTrailingLength)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if protoWriter.header.flags&FlagTrailingLength == 0 {
+		file.Close()
+		return nil, ErrIncompatibleFlags
+	}
+	return &FileDeque{
+		filePath:   filePath,
+		writer:     protoWriter,
+		serializer: serializer,
+	}, nil
+}
+
+// Same as PushBack, to satisfy the Queue interface.
+func (d *FileDeque) Push(element interface{}) error {
+	return d.PushBack(element)
+}
+
+// Same as PollFront, to satisfy the Queue interface.
+func (d *FileDeque) Poll() (interface{}, error) {
+	return d.PollFront()
+}
+
+// Same as PeekFront, to satisfy the Queue interface.
+func (d *FileDeque) Peek() (interface{}, error) {
+	return d.PeekFront()
+}
+
+// Adds the element after the current tail of the deque.
+func (d *FileDeque) PushBack(element interface{}) error {
+	if err := d.writer.writable(); err != nil {
+		return err
+	}
+	data := d.serializer.Write(element)
+	header := d.writer.header
+	dataLength := int64(len(data))
+	offset := header.tail.offset
+	if d.Size() != 0 {
+		offset = header.tail.offset + header.tail.length + 16
+	}
+	if err := d.writeElement(offset, data); err != nil {
+		return err
+	}
+	header.tail = &elementPtr{offset: offset, length: dataLength}
+	if d.Size() == 0 {
+		header.head = &elementPtr{offset: offset, length: dataLength}
+	}
+	header.elementCount++
+	return writeHeader(d.writer.backingFile, header)
+}
+
+// Adds the element before the current head of the deque.
+func (d *FileDeque) PushFront(element interface{}) error {
+	if err := d.writer.writable(); err != nil {
+		return err
+	}
+	if d.Size() == 0 {
+		return d.PushBack(element)
+	}
+	data := d.serializer.Write(element)
+	header := d.writer.header
+	dataLength := int64(len(data))
+	needed := dataLength + 16
+	if header.head.offset-headerSize < needed {
+		if err := d.makeRoom(needed); err != nil {
+			return err
+		}
+	}
+	offset := header.head.offset - needed
+	if err := d.writeElement(offset, data); err != nil {
+		return err
+	}
+	header.head = &elementPtr{offset: offset, length: dataLength}
+	header.elementCount++
+	return writeHeader(d.writer.backingFile, header)
+}
+
+// Removes and returns the head of the deque.
+func (d *FileDeque) PollFront() (interface{}, error) {
+	if err := d.writer.writable(); err != nil {
+		return nil, err
+	}
+	if d.Size() == 0 {
+		return nil, EmptyQueueError
+	}
+	header := d.writer.header
+	element, err := d.readElement(header.head)
+	if err != nil {
+		return nil, err
+	}
+	if d.Size() == 1 {
+		d.reset()
+	} else {
+		nextOffset := header.head.offset + header.head.length + 16
+		nextLength, err := ReadLong(d.writer.backingFile, nextOffset)
+		if err != nil {
+			return nil, err
+		}
+		header.head = &elementPtr{offset: nextOffset, length: nextLength}
+		header.elementCount--
+	}
+	if err := writeHeader(d.writer.backingFile, header); err != nil {
+		return nil, err
+	}
+	return element, nil
+}
+
+// Removes and returns the tail of the deque.
+func (d *FileDeque) PollBack() (interface{}, error) {
+	if err := d.writer.writable(); err != nil {
+		return nil, err
+	}
+	if d.Size() == 0 {
+		return nil, EmptyQueueError
+	}
+	header := d.writer.header
+	element, err := d.readElement(header.tail)
+	if err != nil {
+		return nil, err
+	}
+	if d.Size() == 1 {
+		d.reset()
+	} else {
+		previousLength, err := ReadLong(d.writer.backingFile, header.tail.offset-8)
+		if err != nil {
+			return nil, err
+		}
+		header.tail = &elementPtr{offset: header.tail.offset - previousLength - 16, length: previousLength}
+		header.elementCount--
+	}
+	if err := writeHeader(d.writer.backingFile, header); err != nil {
+		return nil, err
+	}
+	return element, nil
+}
+
+// Returns the head of the deque without removing it.
+func (d *FileDeque) PeekFront() (interface{}, error) {
+	if err := d.writer.checkOpen(); err != nil {
+		return nil, err
+	}
+	if d.Size() == 0 {
+		return nil, EmptyQueueError
+	}
+	return d.readElement(d.writer.header.head)
+}
+
+// Returns the tail of the deque without removing it.
+func (d *FileDeque) PeekBack() (interface{}, error) {
+	if err := d.writer.checkOpen(); err != nil {
+		return nil, err
+	}
+	if d.Size() == 0 {
+		return nil, EmptyQueueError
+	}
+	return d.readElement(d.writer.header.tail)
+}
+
+func (d *FileDeque) Size() int64 {
+	return d.writer.header.elementCount
+}
+
+// Closes the deque and deletes it's file.
+func (d *FileDeque) Delete() error {
+	if err := d.writer.close(); err != nil {
+		return err
+	}
+	return os.Remove(d.filePath)
+}
+
+// Syncs and closes the file of the deque, every operation fails with ErrQueueClosed afterwards.
+func (d *FileDeque) Close() error {
+	return d.writer.close()
+}
+
+func (d *FileDeque) elementSerializer() Serializer {
+	return d.serializer
+}
+
+// Visits the serialized elements from the head to the tail.
+func (d *FileDeque) rawElements(visit func(data []byte) bool) error {
+	if err := d.writer.checkOpen(); err != nil {
+		return err
+	}
+	header := d.writer.header
+	offset := header.head.offset
+	for i := int64(0); i < header.elementCount; i++ {
+		length, err := ReadLong(d.writer.backingFile, offset)
+		if err != nil {
+			return err
+		}
+		data, err := ReadChunk(d.writer.backingFile, offset+8, length)
+		if err != nil {
+			return err
+		}
+		if !visit(data) {
+			return nil
+		}
+		offset += length + 16
+	}
+	return nil
+}
+
+// Writes the element framed as [length, data, length] starting at the given offset.
+func (d *FileDeque) writeElement(offset int64, data []byte) error {
+	dataLength := int64(len(data))
+	if _, err := WriteLong(d.writer.backingFile, offset, dataLength); err != nil {
+		return err
+	}
+	if _, err := WriteChunk(d.writer.backingFile, offset+8, data); err != nil {
+		return err
+	}
+	if _, err := WriteLong(d.writer.backingFile, offset+8+dataLength, dataLength); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d *FileDeque) readElement(ptr *elementPtr) (interface{}, error) {
+	data, err := ReadChunk(d.writer.backingFile, ptr.offset+8, ptr.length)
+	if err != nil {
+		return nil, err
+	}
+	return d.serializer.Read(bytes.NewReader(data)), nil
+}
+
+// Moves the live elements further in the file, so that at least `needed` bytes are free before the head.
+// The live elements are copied past their current end, so the old copy stays valid until the header is updated.
+func (d *FileDeque) makeRoom(needed int64) error {
+	header := d.writer.header
+	liveEnd := header.tail.offset + header.tail.length + 16
+	if err := moveLiveElements(d.writer.backingFile, header, headerSize, liveEnd, needed); err != nil {
+		return err
+	}
+	return writeHeader(d.writer.backingFile, header)
+}
+
+// Moves the live elements, from the head of the header to liveEnd, further in the file so that `needed` bytes are
+// free between start and the head. As much free space as the live elements take is left in front of them, to
+// amortize the cost of the next moves, which also means they are copied past their current end: the old copy is
+// untouched until the header is written.
+// The head and the tail of the header are moved, the header is not written.
+func moveLiveElements(file Storage, header *header, start, liveEnd, needed int64) error {
+	liveLength := liveEnd - header.head.offset
+	live, err := ReadChunk(file, header.head.offset, liveLength)
+	if err != nil {
+		return err
+	}
+	newHeadOffset := start + needed + liveLength
+	if _, err := WriteChunk(file, newHeadOffset, live); err != nil {
+		return err
+	}
+	shift := newHeadOffset - header.head.offset
+	header.head = &elementPtr{offset: header.head.offset + shift, length: header.head.length, index: header.head.index}
+	header.tail = &elementPtr{offset: header.tail.offset + shift, length: header.tail.length, index: header.tail.index}
+	return nil
+}
+
+// Points the head and the tail back to the start of the file, once the deque is empty.
+func (d *FileDeque) reset() {
+	header := d.writer.header
+	header.elementCount = 0
+	header.head = &elementPtr{offset: headerSize, length: 0}
+	header.tail = &elementPtr{offset: headerSize, length: 0}
+}
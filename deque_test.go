@@ -0,0 +1,112 @@
+package eunomia
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileDeque_PushBackPollFront(t *testing.T) {
+	deque, err := NewFileDeque("some-deque", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer deque.Delete()
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, deque.PushBack(MockData{int32(i)}))
+	}
+	assert.Equal(t, int64(10), deque.Size())
+
+	for i := 0; i < 10; i++ {
+		el, err := deque.PollFront()
+		assert.NoError(t, err)
+		assert.Equal(t, int32(i), el.(MockData).value)
+	}
+	_, err = deque.PollFront()
+	assert.Same(t, EmptyQueueError, err)
+}
+
+func TestFileDeque_PushFrontPollBack(t *testing.T) {
+	deque, err := NewFileDeque("some-deque", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer deque.Delete()
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, deque.PushFront(MockData{int32(i)}))
+	}
+
+	el, err := deque.PeekFront()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(9), el.(MockData).value)
+	el, err = deque.PeekBack()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), el.(MockData).value)
+
+	for i := 0; i < 10; i++ {
+		el, err := deque.PollBack()
+		assert.NoError(t, err)
+		assert.Equal(t, int32(i), el.(MockData).value)
+	}
+	_, err = deque.PollBack()
+	assert.Same(t, EmptyQueueError, err)
+}
+
+func TestFileDeque_MixedOperationsSurviveRestart(t *testing.T) {
+	deque, err := NewFileDeque("some-deque", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer deque.Delete()
+
+	assert.NoError(t, deque.PushBack(MockData{2}))
+	assert.NoError(t, deque.PushFront(MockData{1}))
+	assert.NoError(t, deque.PushBack(MockData{3}))
+	assert.NoError(t, deque.PushFront(MockData{0}))
+
+	restored, err := NewFileDeque("some-deque", &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), restored.Size())
+
+	el, err := restored.PollBack()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), el.(MockData).value)
+	for i := 0; i < 3; i++ {
+		el, err := restored.PollFront()
+		assert.NoError(t, err)
+		assert.Equal(t, int32(i), el.(MockData).value)
+	}
+}
+
+func TestFileDeque_RejectsQueueFile(t *testing.T) {
+	queue, err := NewFileQueue("some-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer queue.Delete()
+	assert.NoError(t, queue.Push(MockData{1}))
+
+	opened := openFiles(t)
+	_, err = NewFileDeque("some-queue", &MockDataSerializer{})
+	assert.Same(t, ErrIncompatibleFlags, err)
+	// the file opened to read the header is closed.
+	assert.Equal(t, opened, openFiles(t))
+}
+
+// Returns the number of files opened by the process, the test is skipped where it cannot be known.
+func openFiles(t *testing.T) int {
+	entries, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("the open files are not listed in /proc/self/fd")
+	}
+	return len(entries)
+}
+
+func TestFileDeque_Close(t *testing.T) {
+	stack, err := NewFileStack("some-deque", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer stack.Delete()
+	assert.NoError(t, stack.Push(MockData{1}))
+	assert.NoError(t, stack.Close())
+
+	assert.Same(t, ErrQueueClosed, stack.Push(MockData{2}))
+	_, err = stack.Pop()
+	assert.Same(t, ErrQueueClosed, err)
+	_, err = stack.Peek()
+	assert.Same(t, ErrQueueClosed, err)
+}
@@ -2,6 +2,8 @@ package eunomia
 
 import (
 	"io"
+	"sync"
+	"time"
 )
 
 // TODO(chermehdi): Fix the io.WriterAt and io.ReaderAt not many implementers.
@@ -39,10 +41,8 @@ func ReadString(file io.ReaderAt, offset int64) (string, error) {
 
 // Write an int32 at the given offset.
 func WriteInt(file io.WriterAt, offset int64, value int32) (int64, error) {
-	buffer[0] = byte(value >> 24)
-	buffer[1] = byte(value >> 16)
-	buffer[2] = byte(value >> 8)
-	buffer[3] = byte(value)
+	buffer := make([]byte, 4)
+	putInt(buffer, value)
 	written, err := file.WriteAt(buffer[0:4], offset)
 	if err != nil {
 		return -1, err
@@ -56,14 +56,8 @@ func WriteInt(file io.WriterAt, offset int64, value int32) (int64, error) {
 // Write an int64 value in the given offset of the file.
 // If the value cannot be written to the file an error is returned.
 func WriteLong(file io.WriterAt, offset int64, value int64) (int64, error) {
-	buffer[0] = byte(value >> 56)
-	buffer[1] = byte(value >> 48)
-	buffer[2] = byte(value >> 40)
-	buffer[3] = byte(value >> 32)
-	buffer[4] = byte(value >> 24)
-	buffer[5] = byte(value >> 16)
-	buffer[6] = byte(value >> 8)
-	buffer[7] = byte(value)
+	buffer := make([]byte, 8)
+	putLong(buffer, value)
 	written, err := file.WriteAt(buffer[0:8], offset)
 	if err != nil {
 		return -1, err
@@ -74,14 +68,38 @@ func WriteLong(file io.WriterAt, offset int64, value int64) (int64, error) {
 	return offset + 8, nil
 }
 
+// Encodes the value in the first 4 bytes of the buffer, in big endian order.
+func putInt(buffer []byte, value int32) {
+	buffer[0] = byte(value >> 24)
+	buffer[1] = byte(value >> 16)
+	buffer[2] = byte(value >> 8)
+	buffer[3] = byte(value)
+}
+
+// Encodes the value in the first 8 bytes of the buffer, in big endian order.
+func putLong(buffer []byte, value int64) {
+	buffer[0] = byte(value >> 56)
+	buffer[1] = byte(value >> 48)
+	buffer[2] = byte(value >> 40)
+	buffer[3] = byte(value >> 32)
+	buffer[4] = byte(value >> 24)
+	buffer[5] = byte(value >> 16)
+	buffer[6] = byte(value >> 8)
+	buffer[7] = byte(value)
+}
+
 // Read an int32 at the given offset
 func ReadInt(file io.ReaderAt, offset int64) (int32, error) {
 	buffer, err := ReadChunk(file, offset, 4)
 	if err != nil {
 		return -1, err
 	}
-	result := (int32(buffer[0]&0xff) << 24) + (int32(buffer[1]&0xff) << 16) + (int32(buffer[2]&0xff) << 8) + int32(buffer[3])
-	return result, nil
+	return getInt(buffer), nil
+}
+
+// Decodes the int32 value stored in the first 4 bytes of the buffer.
+func getInt(buffer []byte) int32 {
+	return (int32(buffer[0]&0xff) << 24) + (int32(buffer[1]&0xff) << 16) + (int32(buffer[2]&0xff) << 8) + int32(buffer[3])
 }
 
 // Read an int64 at the given offset
@@ -90,8 +108,12 @@ func ReadLong(file io.ReaderAt, offset int64) (int64, error) {
 	if err != nil {
 		return -1, err
 	}
-	result := (int64(buffer[0]&0xff) << 56) + (int64(buffer[1]&0xff) << 48) + (int64(buffer[2]&0xff) << 40) + (int64(buffer[3]) << 32) + (int64(buffer[4]) << 24) + (int64(buffer[5]) << 16) + (int64(buffer[6]) << 8) + (int64(buffer[7]))
-	return result, nil
+	return getLong(buffer), nil
+}
+
+// Decodes the int64 value stored in the first 8 bytes of the buffer.
+func getLong(buffer []byte) int64 {
+	return (int64(buffer[0]&0xff) << 56) + (int64(buffer[1]&0xff) << 48) + (int64(buffer[2]&0xff) << 40) + (int64(buffer[3]) << 32) + (int64(buffer[4]) << 24) + (int64(buffer[5]) << 16) + (int64(buffer[6]) << 8) + (int64(buffer[7]))
 }
 
 // Read a chunk of data starting at the given offset and ending at offset + length - 1.
@@ -114,29 +136,40 @@ func WriteChunk(file io.WriterAt, offset int64, data []byte) (int, error) {
 	return written, nil
 }
 
+// Buffers used to encode the headers, so that writing a header does not allocate.
+var headerBuffers = sync.Pool{
+	New: func() interface{} {
+		buffer := make([]byte, headerSize+capacitySize)
+		return &buffer
+	},
+}
+
 // Writes the passed header as specified by the protocol description to the
 // queue file. If an error occurs during writing and error is returned.
+// The header is encoded in memory first, and written with a single write, it's last_updated_at is set to the current time.
 func writeHeader(file io.WriterAt, header *header) error {
-	currentOffset := int64(0)
-	currentOffset, err := WriteInt(file, currentOffset, header.version)
+	pooled := headerBuffers.Get().(*[]byte)
+	defer headerBuffers.Put(pooled)
+	header.updatedAt = time.Now().UnixNano()
+	buffer := (*pooled)[:headerSize]
+	putInt(buffer[0:], header.version)
+	putInt(buffer[4:], header.flags)
+	putLong(buffer[8:], header.createdAt)
+	putLong(buffer[16:], header.updatedAt)
+	putLong(buffer[24:], header.elementCount)
+	putLong(buffer[32:], header.head.offset)
+	putLong(buffer[40:], header.tail.offset)
+	if header.flags&FlagBounded != 0 {
+		buffer = (*pooled)[:headerSize+capacitySize]
+		putLong(buffer[headerSize:], header.maxElements)
+		putLong(buffer[headerSize+8:], header.maxBytes)
+	}
+	written, err := file.WriteAt(buffer, 0)
 	if err != nil {
 		return err
 	}
-	currentOffset, err = WriteInt(file, currentOffset, header.flags)
-	if err != nil {
-		return err
-	}
-	currentOffset, err = WriteLong(file, currentOffset, header.elementCount)
-	if err != nil {
-		return err
-	}
-	currentOffset, err = WriteLong(file, currentOffset, header.head.offset)
-	if err != nil {
-		return err
-	}
-	currentOffset, err = WriteLong(file, currentOffset, header.tail.offset)
-	if err != nil {
-		return err
+	if written != len(buffer) {
+		return UnexpectedNumberOfWrittenBytesError
 	}
 	return nil
 }
@@ -0,0 +1,237 @@
+package eunomia
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Format of the stream written by Export.
+type ExportFormat int
+
+const (
+	// JSON Lines, one JSON object per element, see ExportRecord.
+	FormatJSONL ExportFormat = iota
+	// A stream of elements encoded like in the queue file: the 8 bytes big endian length followed by the data.
+	FormatBinary
+)
+
+var (
+	ErrUnknownFormat     = errors.New("unknown export format")
+	ErrUnsupportedExport = errors.New("the queue type does not support export and import")
+)
+
+// Number of imported elements pushed to the queue at once.
+const importBatchSize = 256
+
+// A Serializer able to render the elements as JSON, Export uses it to write the elements as readable JSON values
+// instead of their base64 encoded serialized form.
+type JSONSerializer interface {
+	Serializer
+
+	ToJSON(element interface{}) ([]byte, error)
+
+	FromJSON(data []byte) (interface{}, error)
+}
+
+// A line of the JSON Lines export, only one of Element and Data is set.
+// The queues don't keep any metadata about their elements (push time, delivery attempts ...), an element carrying
+// such metadata must hold it itself, and it's exported with the element. The FileLog, which records the append time
+// of it's elements, is not a Queue and cannot be exported.
+type ExportRecord struct {
+	// position of the element in the queue at the time of the export, starting at 0.
+	Index int64 `json:"index"`
+	// the element rendered by the JSONSerializer of the queue.
+	Element json.RawMessage `json:"element,omitempty"`
+	// the serialized element, when the serializer of the queue cannot render JSON.
+	Data []byte `json:"data,omitempty"`
+}
+
+// The queues supported by Export and Import: FileQueue, MemoryQueue, BufferedQueue and FileDeque.
+type exportable interface {
+	Queue
+
+	elementSerializer() Serializer
+
+	// Calls visit with the serialized form of the elements present in the queue when the call starts, in the order
+	// they were pushed, until visit returns false. The data is only valid during the call to visit.
+	rawElements(visit func(data []byte) bool) error
+}
+
+// Writes the elements present in the queue when the export starts to the writer, in the order they were pushed,
+// without consuming them. Only the FileQueue, MemoryQueue, BufferedQueue and FileDeque can be exported,
+// the other queues fail with ErrUnsupportedExport.
+// Pushes and polls can run concurrently with the export of a FileQueue, the elements polled during the export are
+// skipped. A BufferedQueue is locked during the whole export.
+func Export(queue Queue, w io.Writer, format ExportFormat) error {
+	if format != FormatJSONL && format != FormatBinary {
+		return ErrUnknownFormat
+	}
+	source, ok := queue.(exportable)
+	if !ok {
+		return ErrUnsupportedExport
+	}
+	serializer := source.elementSerializer()
+	jsonSerializer, renders := serializer.(JSONSerializer)
+	out := bufio.NewWriter(w)
+	encoder := json.NewEncoder(out)
+	length := make([]byte, 8)
+	index := int64(-1)
+	var err error
+	visitErr := source.rawElements(func(data []byte) bool {
+		index++
+		if format == FormatBinary {
+			putLong(length, int64(len(data)))
+			if _, err = out.Write(length); err != nil {
+				return false
+			}
+			_, err = out.Write(data)
+			return err == nil
+		}
+		record := ExportRecord{Index: index}
+		if renders {
+			if record.Element, err = jsonSerializer.ToJSON(serializer.Read(bytes.NewReader(data))); err != nil {
+				return false
+			}
+		} else {
+			record.Data = data
+		}
+		err = encoder.Encode(&record)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	if visitErr != nil {
+		return visitErr
+	}
+	return out.Flush()
+}
+
+// Pushes every element read from the reader to the tail of the queue, in order, and returns the number of pushed
+// elements. The format of the stream is detected: a JSON Lines export starts with a '{', while the first byte of a
+// binary export is the high byte of a length, always 0.
+// Elements exported as JSON can only be imported in a queue whose serializer is a JSONSerializer. The queues
+// supported by Export can be imported to, the other ones fail with ErrUnsupportedExport.
+//
+// The import stops at the first element that cannot be pushed, so the returned count is the number of elements at
+// the start of the stream found in the queue, and the import can be resumed after them. An element dropped by a full
+// OverflowDropNewest queue stops the import with ErrQueueFull. The elements are pushed to an unbounded FileQueue in
+// batches, each batch being written at once.
+func Import(r io.Reader, queue Queue) (int64, error) {
+	target, ok := queue.(exportable)
+	if !ok {
+		return 0, ErrUnsupportedExport
+	}
+	serializer := target.elementSerializer()
+	in := bufio.NewReader(r)
+	first, err := in.Peek(1)
+	if err == io.EOF {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	next := nextBinary(in)
+	if first[0] != 0 {
+		next = nextJSON(in, serializer)
+	}
+	push := func(batch [][]byte) (int64, error) {
+		for i, data := range batch {
+			if err := queue.Push(serializer.Read(bytes.NewReader(data))); err != nil {
+				return int64(i), err
+			}
+		}
+		return int64(len(batch)), nil
+	}
+	disk, ok := queue.(*FileQueue)
+	if buffered, isBuffered := queue.(*BufferedQueue); isBuffered && buffered.bufferSize == 0 {
+		// an unbuffered queue, like the bounded ones, pushes straight to it's disk queue.
+		disk, ok = buffered.disk, true
+	}
+	if ok {
+		push = func(batch [][]byte) (int64, error) {
+			return disk.pushPrefix(context.Background(), batch)
+		}
+	}
+	imported := int64(0)
+	batch := make([][]byte, 0, importBatchSize)
+	for {
+		data, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return imported, err
+		}
+		batch = append(batch, data)
+		if len(batch) == importBatchSize {
+			pushed, err := push(batch)
+			imported += pushed
+			if err != nil {
+				return imported, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		pushed, err := push(batch)
+		imported += pushed
+		if err != nil {
+			return imported, err
+		}
+	}
+	return imported, nil
+}
+
+// Returns a function reading the next element of a binary export, io.EOF is returned at the end of the stream.
+func nextBinary(in io.Reader) func() ([]byte, error) {
+	length := make([]byte, 8)
+	return func() ([]byte, error) {
+		if _, err := io.ReadFull(in, length); err != nil {
+			return nil, err
+		}
+		dataLength := getLong(length)
+		if dataLength < 0 {
+			return nil, fmt.Errorf("invalid element length %d", dataLength)
+		}
+		data := make([]byte, dataLength)
+		if _, err := io.ReadFull(in, data); err != nil {
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		return data, nil
+	}
+}
+
+// Returns a function reading the next record of a JSON Lines export, io.EOF is returned at the end of the stream.
+func nextJSON(in io.Reader, serializer Serializer) func() ([]byte, error) {
+	decoder := json.NewDecoder(in)
+	return func() ([]byte, error) {
+		var record ExportRecord
+		if err := decoder.Decode(&record); err != nil {
+			return nil, err
+		}
+		if record.Element == nil {
+			if record.Data == nil {
+				return []byte{}, nil
+			}
+			return record.Data, nil
+		}
+		jsonSerializer, ok := serializer.(JSONSerializer)
+		if !ok {
+			return nil, fmt.Errorf("the element %d is exported as JSON, but the serializer of the queue is not a JSONSerializer", record.Index)
+		}
+		element, err := jsonSerializer.FromJSON(record.Element)
+		if err != nil {
+			return nil, err
+		}
+		return jsonSerializer.Write(element), nil
+	}
+}
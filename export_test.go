@@ -0,0 +1,202 @@
+package eunomia
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// renders MockData as a JSON number.
+type JSONMockDataSerializer struct {
+	MockDataSerializer
+}
+
+func (j *JSONMockDataSerializer) ToJSON(element interface{}) ([]byte, error) {
+	return json.Marshal(element.(MockData).value)
+}
+
+func (j *JSONMockDataSerializer) FromJSON(data []byte) (interface{}, error) {
+	var value int32
+	err := json.Unmarshal(data, &value)
+	return MockData{value}, err
+}
+
+func TestExport_JSONL(t *testing.T) {
+	queue, err := NewStorageQueue(NewMemoryStorage(), &JSONMockDataSerializer{})
+	assert.NoError(t, err)
+	for i := int32(0); i < 4; i++ {
+		assert.NoError(t, queue.Push(MockData{i}))
+	}
+	_, err = queue.Poll()
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	assert.NoError(t, Export(queue, &out, FormatJSONL))
+	assert.Equal(t, "{\"index\":0,\"element\":1}\n{\"index\":1,\"element\":2}\n{\"index\":2,\"element\":3}\n", out.String())
+	assert.Equal(t, int64(3), queue.Size())
+
+	restored, err := NewStorageQueue(NewMemoryStorage(), &JSONMockDataSerializer{})
+	assert.NoError(t, err)
+	imported, err := Import(&out, restored)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), imported)
+	for i := int32(1); i < 4; i++ {
+		el, err := restored.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, MockData{i}, el)
+	}
+}
+
+func TestExport_JSONLWithoutJSONSerializer(t *testing.T) {
+	queue, err := NewStorageQueue(NewMemoryStorage(), &BytesSerializer{})
+	assert.NoError(t, err)
+	assert.NoError(t, queue.Push([]byte("hello")))
+	assert.NoError(t, queue.Push([]byte{}))
+
+	var out bytes.Buffer
+	assert.NoError(t, Export(queue, &out, FormatJSONL))
+	assert.Equal(t, "{\"index\":0,\"data\":\"aGVsbG8=\"}\n{\"index\":1}\n", out.String())
+
+	restored, err := NewStorageQueue(NewMemoryStorage(), &BytesSerializer{})
+	assert.NoError(t, err)
+	imported, err := Import(&out, restored)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), imported)
+	el, err := restored.Poll()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), el)
+	el, err = restored.Poll()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{}, el)
+
+	// elements rendered as JSON need a JSONSerializer to be imported.
+	_, err = Import(strings.NewReader("{\"index\":0,\"element\":1}\n"), restored)
+	assert.Error(t, err)
+}
+
+func TestExport_Binary(t *testing.T) {
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
+		for i := int32(0); i < 600; i++ {
+			assert.NoError(t, queue.Push(MockData{i}))
+		}
+
+		var out bytes.Buffer
+		assert.NoError(t, Export(queue, &out, FormatBinary))
+		assert.Equal(t, 600*12, out.Len())
+		assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 4, 0, 0, 0, 0}, out.Bytes()[:12])
+
+		restored, err := NewStorageQueue(NewMemoryStorage(), &MockDataSerializer{})
+		assert.NoError(t, err)
+		imported, err := Import(bytes.NewReader(out.Bytes()), restored)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(600), imported)
+		for i := int32(0); i < 600; i++ {
+			el, err := restored.Poll()
+			assert.NoError(t, err)
+			assert.Equal(t, MockData{i}, el)
+		}
+
+		// a stream cut in the middle of an element.
+		_, err = Import(bytes.NewReader(out.Bytes()[:18]), restored)
+		assert.Error(t, err)
+	})
+}
+
+func TestExport_Errors(t *testing.T) {
+	queue, err := NewStorageQueue(NewMemoryStorage(), &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.Equal(t, ErrUnknownFormat, Export(queue, &bytes.Buffer{}, ExportFormat(42)))
+
+	imported, err := Import(strings.NewReader(""), queue)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), imported)
+}
+
+func TestExport_OtherQueueTypes(t *testing.T) {
+	memory := NewMemoryQueue(&JSONMockDataSerializer{})
+	deque, err := NewFileDeque("export-deque", &JSONMockDataSerializer{})
+	assert.NoError(t, err)
+	defer deque.Delete()
+	disk, err := OpenFileQueue("export-queue", &JSONMockDataSerializer{})
+	assert.NoError(t, err)
+	defer disk.Delete()
+	buffered := NewBufferedQueue(disk, 2, false)
+
+	for _, queue := range []Queue{memory, deque, buffered} {
+		for i := int32(0); i < 3; i++ {
+			assert.NoError(t, queue.Push(MockData{i}))
+		}
+		var out bytes.Buffer
+		assert.NoError(t, Export(queue, &out, FormatJSONL))
+		assert.Equal(t, "{\"index\":0,\"element\":0}\n{\"index\":1,\"element\":1}\n{\"index\":2,\"element\":2}\n", out.String())
+
+		restored := NewMemoryQueue(&JSONMockDataSerializer{})
+		imported, err := Import(&out, restored)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), imported)
+		for i := int32(0); i < 3; i++ {
+			el, err := restored.Poll()
+			assert.NoError(t, err)
+			assert.Equal(t, MockData{i}, el)
+		}
+	}
+
+	segmented, err := NewSegmentedQueue("export-segments", &MockDataSerializer{}, 1024)
+	assert.NoError(t, err)
+	defer segmented.Delete()
+	assert.Same(t, ErrUnsupportedExport, Export(segmented, &bytes.Buffer{}, FormatBinary))
+	_, err = Import(strings.NewReader(""), segmented)
+	assert.Same(t, ErrUnsupportedExport, err)
+}
+
+func TestImport_BoundedQueueCountsPushedElements(t *testing.T) {
+	queue, err := NewBoundedFileQueue("export-queue", &MockDataSerializer{}, Capacity{MaxElements: 2})
+	assert.NoError(t, err)
+	defer queue.Delete()
+	var stream bytes.Buffer
+	for i := int32(0); i < 3; i++ {
+		stream.Write([]byte{0, 0, 0, 0, 0, 0, 0, 4})
+		stream.Write(toBytes(i))
+	}
+	imported, err := Import(&stream, queue)
+	assert.Same(t, ErrQueueFull, err)
+	assert.Equal(t, int64(2), imported)
+	assert.Equal(t, int64(2), queue.Size())
+}
+
+func TestImport_StopsAtFirstRejectedElement(t *testing.T) {
+	element := func(stream *bytes.Buffer, length int) {
+		stream.Write(toBytes64(int64(length)))
+		stream.Write(make([]byte, length))
+	}
+	// the small element after the rejected large one would fit, it's not pushed.
+	queue, err := NewBoundedFileQueue("export-queue", &MockDataSerializer{}, Capacity{MaxBytes: 40})
+	assert.NoError(t, err)
+	var stream bytes.Buffer
+	element(&stream, 4)
+	element(&stream, 30)
+	element(&stream, 4)
+	imported, err := Import(&stream, queue)
+	assert.Same(t, ErrQueueFull, err)
+	assert.Equal(t, int64(1), imported)
+	assert.Equal(t, int64(1), queue.Size())
+	assert.NoError(t, queue.Delete())
+
+	// the dropped elements are not counted.
+	queue, err = NewBoundedFileQueue("export-queue", &MockDataSerializer{}, Capacity{MaxElements: 1, Policy: OverflowDropNewest})
+	assert.NoError(t, err)
+	defer queue.Delete()
+	stream.Reset()
+	element(&stream, 4)
+	element(&stream, 4)
+	imported, err = Import(&stream, queue)
+	assert.Same(t, ErrQueueFull, err)
+	assert.Equal(t, int64(1), imported)
+	assert.Equal(t, int64(1), queue.Size())
+	// the pushes still report a dropped element as a success.
+	assert.NoError(t, queue.Push(MockData{1}))
+}
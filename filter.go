@@ -0,0 +1,113 @@
+package eunomia
+
+import "bytes"
+
+// Removes every element matching the predicate, keeping the remaining elements in FIFO order.
+// Returns the number of removed elements.
+func (f *FileQueue) RemoveIf(predicate func(interface{}) bool) (int, error) {
+	return f.rewrite(func(element interface{}, data []byte) ([]byte, bool) {
+		if predicate(element) {
+			return nil, true
+		}
+		return data, false
+	})
+}
+
+// Replaces every element matching the predicate by the result of calling replacement on it, without changing the
+// position of the element in the queue. Returns the number of replaced elements.
+func (f *FileQueue) ReplaceIf(predicate func(interface{}) bool, replacement func(interface{}) interface{}) (int, error) {
+	return f.rewrite(func(element interface{}, data []byte) ([]byte, bool) {
+		if predicate(element) {
+			return f.serializer.Write(replacement(element)), true
+		}
+		return data, false
+	})
+}
+
+// Rewrites the live elements of the queue.
+// The transform function receives every element (and it's serialized form) and returns the data to write in it's
+// place, or nil to drop it, along with whether the element was affected. The elements that are not affected are
+// written back as they are stored.
+// The elements are streamed one by one to a new copy written after the live ones, the header is switched to the new
+// copy once it's synced, and the queue is compacted, so a crash leaves either the previous elements or the rewritten
+// ones. Nothing is kept if no element was affected.
+//
+// Iterators created before the rewrite start over from the new head.
+func (f *FileQueue) rewrite(transform func(element interface{}, data []byte) ([]byte, bool)) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.writable(); err != nil {
+		return 0, err
+	}
+	current := f.writer.header
+	if current.elementCount == 0 {
+		return 0, nil
+	}
+	size, err := f.writer.backingFile.Size()
+	if err != nil {
+		return 0, err
+	}
+	f.ahead.invalidate()
+	start := f.liveEnd()
+	// the new indexes start after the old tail, so that the existing iterators see the old elements as polled.
+	updatedHeader := *current
+	updatedHeader.elementCount = 0
+	updatedHeader.head = &elementPtr{offset: start, index: current.tail.index + 1}
+	updatedHeader.tail = &elementPtr{offset: start, index: current.tail.index + 1}
+	affected := 0
+	offset := start
+	ptr := current.head
+	for i := int64(0); i < current.elementCount; i++ {
+		if i > 0 {
+			next, err := f.next(ptr)
+			if err != nil {
+				return 0, err
+			}
+			ptr = &next
+		}
+		stored, err := ReadChunk(f.writer.backingFile, ptr.offset+8, ptr.length)
+		if err != nil {
+			return 0, err
+		}
+		data, err := f.decode(stored)
+		if err != nil {
+			return 0, err
+		}
+		newData, changed := transform(f.serializer.Read(bytes.NewReader(data)), data)
+		if changed {
+			affected++
+			if newData == nil {
+				continue
+			}
+			stored = f.encode(nil, newData)
+		}
+		dataLength := int64(len(stored))
+		if _, err := WriteLong(f.writer.backingFile, offset, dataLength); err != nil {
+			return 0, err
+		}
+		if _, err := WriteChunk(f.writer.backingFile, offset+8, stored); err != nil {
+			return 0, err
+		}
+		if updatedHeader.elementCount == 0 {
+			updatedHeader.head.length = dataLength
+		}
+		updatedHeader.tail = &elementPtr{
+			offset: offset,
+			length: dataLength,
+			index:  updatedHeader.head.index + updatedHeader.elementCount,
+		}
+		updatedHeader.elementCount++
+		offset += 8 + dataLength
+	}
+	if affected == 0 {
+		return 0, f.writer.backingFile.Truncate(size)
+	}
+	if err := f.switchHeader(&updatedHeader); err != nil {
+		return 0, err
+	}
+	f.signalSpace()
+	if _, err := f.compact(); err != nil {
+		return 0, err
+	}
+	return affected, nil
+}
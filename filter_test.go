@@ -0,0 +1,113 @@
+package eunomia
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFileQueue_RemoveIf(t *testing.T) {
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
+
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, queue.Push(MockData{int32(i)}))
+		}
+		removed, err := queue.RemoveIf(func(element interface{}) bool {
+			return element.(MockData).value%2 == 0
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 5, removed)
+		assert.Equal(t, int64(5), queue.Size())
+
+		restored := open()
+		assert.Equal(t, int64(5), restored.Size())
+		for i := 1; i < 10; i += 2 {
+			el, err := restored.Poll()
+			assert.NoError(t, err)
+			assert.Equal(t, int32(i), el.(MockData).value)
+		}
+	})
+}
+
+func TestFileQueue_RemoveIfEverything(t *testing.T) {
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
+
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, queue.Push(MockData{int32(i)}))
+		}
+		removed, err := queue.RemoveIf(func(element interface{}) bool {
+			return true
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, removed)
+		_, err = queue.Poll()
+		assert.Same(t, EmptyQueueError, err)
+
+		assert.NoError(t, queue.Push(MockData{42}))
+		el, err := queue.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, int32(42), el.(MockData).value)
+	})
+}
+
+func TestFileQueue_ReplaceIf(t *testing.T) {
+	forEachBackend(t, &ComplexSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
+
+		for _, name := range []string{"a", "b", "c"} {
+			assert.NoError(t, queue.Push(ComplexStructure{FirstName: name}))
+		}
+		replaced, err := queue.ReplaceIf(func(element interface{}) bool {
+			return element.(ComplexStructure).FirstName == "b"
+		}, func(element interface{}) interface{} {
+			return ComplexStructure{FirstName: "a much longer replacement"}
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, replaced)
+
+		for _, name := range []string{"a", "a much longer replacement", "c"} {
+			el, err := queue.Poll()
+			assert.NoError(t, err)
+			assert.Equal(t, name, el.(ComplexStructure).FirstName)
+		}
+	})
+}
+
+func TestFileQueue_RewriteSurvivesCrash(t *testing.T) {
+	storage := newCrashStorage()
+	queue, err := NewStorageQueue(storage, &MockDataSerializer{})
+	assert.NoError(t, err)
+	for i := int32(0); i < 10; i++ {
+		assert.NoError(t, queue.Push(MockData{i}))
+	}
+	_, err = queue.Poll()
+	assert.NoError(t, err)
+	storage.states = nil
+	removed, err := queue.RemoveIf(func(element interface{}) bool {
+		return element.(MockData).value%2 == 0
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, removed)
+	info, err := queue.Info()
+	assert.NoError(t, err)
+	assert.Equal(t, headerSize, info.HeadOffset)
+	assert.Equal(t, int64(0), info.WastedBytes)
+
+	// a crash at any point leaves either the previous elements, or the rewritten ones.
+	for _, values := range storage.restoredValues(t) {
+		if len(values) == 9 {
+			assert.Equal(t, []int32{1, 2, 3, 4, 5, 6, 7, 8, 9}, values)
+		} else {
+			assert.Equal(t, []int32{1, 3, 5, 7, 9}, values)
+		}
+	}
+
+	// nothing is left behind when no element is affected.
+	replaced, err := queue.ReplaceIf(func(interface{}) bool { return false }, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, replaced)
+	info, err = queue.Info()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), info.WastedBytes)
+}
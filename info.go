@@ -0,0 +1,93 @@
+package eunomia
+
+import (
+	"os"
+	"time"
+)
+
+// Information about a queue file, read from it's header.
+type Info struct {
+	Version int32
+	Flags   int32
+	// zero if unknown, for the files upgraded from the legacy format.
+	CreatedAt time.Time
+	// the last time the header was written, i.e the last time the queue was modified, zero if unknown.
+	UpdatedAt time.Time
+	Size      int64
+	// offsets of the first and last elements in the file.
+	HeadOffset int64
+	TailOffset int64
+	// number of bytes used by the elements in the queue, including their framing.
+	Bytes int64
+	// size of the file, and the number of bytes of it that are neither the header nor live elements, which Compact
+	// reclaims.
+	FileSize    int64
+	WastedBytes int64
+	// capacity limits of a bounded queue (FlagBounded), 0 means no limit.
+	MaxElements int64
+	MaxBytes    int64
+}
+
+// Returns the information stored in the header of the queue.
+func (f *FileQueue) Info() (Info, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.writer.checkOpen(); err != nil {
+		return Info{}, err
+	}
+	size, err := f.writer.backingFile.Size()
+	if err != nil {
+		return Info{}, err
+	}
+	return newInfo(f.writer.header, dataStart(f.writer.header.flags), size), nil
+}
+
+// Returns the information stored in the header of a queue file of any type (FileQueue, FileDeque, FileStack or
+// FileLog), without opening the queue: the file is neither upgraded nor recovered.
+func ReadInfo(filePath string) (Info, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return Info{}, err
+	}
+	defer file.Close()
+	storage := &FileStorage{file}
+	size, err := storage.Size()
+	if err != nil {
+		return Info{}, err
+	}
+	if size == 0 {
+		return Info{}, NewFileError
+	}
+	header, err := readAnyHeader(storage)
+	if err != nil {
+		return Info{}, err
+	}
+	start := dataStart(header.flags)
+	if header.version == legacyVersionNumber {
+		start -= headerSize - legacyHeaderSize
+	}
+	return newInfo(header, start, size), nil
+}
+
+// Describes the header of a file of the given size, whose elements start at the given offset.
+func newInfo(header *header, start, size int64) Info {
+	info := Info{
+		Version:     header.version,
+		Flags:       header.flags,
+		Size:        header.elementCount,
+		HeadOffset:  header.head.offset,
+		TailOffset:  header.tail.offset,
+		Bytes:       header.end() - header.head.offset,
+		FileSize:    size,
+		MaxElements: header.maxElements,
+		MaxBytes:    header.maxBytes,
+	}
+	info.WastedBytes = size - start - info.Bytes
+	if header.createdAt != 0 {
+		info.CreatedAt = time.Unix(0, header.createdAt)
+	}
+	if header.updatedAt != 0 {
+		info.UpdatedAt = time.Unix(0, header.updatedAt)
+	}
+	return info
+}
@@ -0,0 +1,72 @@
+package eunomia
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFileQueue_Info(t *testing.T) {
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		before := time.Now()
+		queue := open()
+		info, err := queue.Info()
+		assert.NoError(t, err)
+		assert.Equal(t, MagicVersionNumber, info.Version)
+		assert.False(t, info.CreatedAt.Before(before))
+		assert.Equal(t, int64(0), info.Bytes)
+
+		time.Sleep(time.Millisecond)
+		assert.NoError(t, queue.Push(MockData{1}))
+		assert.NoError(t, queue.Push(MockData{2}))
+		_, err = queue.Poll()
+		assert.NoError(t, err)
+
+		updated, err := queue.Info()
+		assert.NoError(t, err)
+		assert.Equal(t, info.CreatedAt, updated.CreatedAt)
+		assert.True(t, updated.UpdatedAt.After(info.UpdatedAt))
+		assert.Equal(t, int64(1), updated.Size)
+		assert.Equal(t, int64(12), updated.Bytes)
+		assert.Equal(t, int64(60), updated.HeadOffset)
+		assert.Equal(t, int64(60), updated.TailOffset)
+		assert.Equal(t, int64(72), updated.FileSize)
+		assert.Equal(t, int64(12), updated.WastedBytes)
+
+		restored, err := open().Info()
+		assert.NoError(t, err)
+		assert.Equal(t, updated.CreatedAt, restored.CreatedAt)
+		assert.Equal(t, updated.UpdatedAt, restored.UpdatedAt)
+	})
+}
+
+func TestReadInfo(t *testing.T) {
+	queue, err := NewBoundedFileQueue("info-queue", &MockDataSerializer{}, Capacity{MaxElements: 5})
+	assert.NoError(t, err)
+	defer queue.Delete()
+	assert.NoError(t, queue.Push(MockData{1}))
+	expected, err := queue.Info()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), expected.MaxElements)
+
+	info, err := ReadInfo("info-queue")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, info)
+
+	_, err = ReadInfo("missing-queue")
+	assert.Error(t, err)
+}
+
+func TestReadInfo_LegacyFile(t *testing.T) {
+	frames, tail := legacyFrames(1, 2)
+	writeLegacyFile(t, "info-queue", 0, legacyHeaderSize, frames, tail)
+	defer os.Remove("info-queue")
+
+	info, err := ReadInfo("info-queue")
+	assert.NoError(t, err)
+	assert.Equal(t, legacyVersionNumber, info.Version)
+	assert.Equal(t, int64(2), info.Size)
+	assert.Equal(t, int64(24), info.Bytes)
+	assert.Equal(t, int64(0), info.WastedBytes)
+}
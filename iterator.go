@@ -0,0 +1,174 @@
+package eunomia
+
+// Walks the elements of a FileQueue from the head to the tail, without consuming them and without touching the header.
+// Every call to Next locks the queue, so pushes and polls from other goroutines can be interleaved with the
+// iteration: elements polled in the meantime are skipped, and elements pushed in the meantime are visited unless the
+// iterator is a snapshot iterator.
+//
+//	it := queue.Iterator()
+//	for it.Next() {
+//		element := it.Value()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator struct {
+	queue *FileQueue
+	// next element to visit, it's length is -1 if the element was not written yet when the pointer was computed.
+	next *elementPtr
+	// index of the last element to visit in snapshot mode.
+	last     int64
+	snapshot bool
+	// set to keep the serialized form of the elements in data, instead of deserializing them.
+	raw   bool
+	value interface{}
+	data  []byte
+	err   error
+}
+
+// Returns an iterator that visits every element of the queue, including the ones pushed during the iteration.
+func (f *FileQueue) Iterator() *Iterator {
+	return f.newIterator(false)
+}
+
+// Returns an iterator that only visits the elements present in the queue when the iterator is created,
+// elements pushed during the iteration are ignored.
+func (f *FileQueue) SnapshotIterator() *Iterator {
+	return f.newIterator(true)
+}
+
+// Returns a sequence over the elements present in the queue when the iteration starts, it's meant to be used with
+// range-over-func:
+//
+//	for element, err := range queue.All() {
+//		...
+//	}
+//
+// If reading an element fails, the error is yielded and the iteration stops.
+func (f *FileQueue) All() func(yield func(interface{}, error) bool) {
+	return func(yield func(interface{}, error) bool) {
+		it := f.SnapshotIterator()
+		for it.Next() {
+			if !yield(it.Value(), nil) {
+				return
+			}
+		}
+		if err := it.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+func (f *FileQueue) elementSerializer() Serializer {
+	return f.serializer
+}
+
+// Visits the serialized elements with a snapshot iterator, see Export.
+func (f *FileQueue) rawElements(visit func(data []byte) bool) error {
+	it := f.SnapshotIterator()
+	it.raw = true
+	for it.Next() {
+		if !visit(it.data) {
+			return nil
+		}
+	}
+	return it.Err()
+}
+
+func (f *FileQueue) newIterator(snapshot bool) *Iterator {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	header := f.writer.header
+	head := *header.head
+	return &Iterator{
+		queue:    f,
+		next:     &head,
+		last:     header.head.index + header.elementCount - 1,
+		snapshot: snapshot,
+	}
+}
+
+// Moves to the next element, returns false when there are no more elements to visit or if an error occurred.
+func (it *Iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.value = nil
+	f := it.queue
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.writer.checkOpen(); err != nil {
+		it.err = err
+		return false
+	}
+	header := f.writer.header
+	if header.elementCount == 0 || it.next.index > header.tail.index {
+		return false
+	}
+	if it.snapshot && it.next.index > it.last {
+		return false
+	}
+	if it.next.index <= header.head.index {
+		// either the element was polled, or the queue was drained and the element was written at the head.
+		head := *header.head
+		it.next = &head
+		// the elements of the snapshot may all have been polled.
+		if it.snapshot && it.next.index > it.last {
+			return false
+		}
+	} else if it.next.length < 0 {
+		length, err := ReadLong(f.writer.backingFile, it.next.offset)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.next.length = length
+	}
+	current := it.next
+	if it.raw {
+		stored, err := f.read(current.offset+8, current.length)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		data, err := f.decode(stored)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		// the read-ahead buffer is reused by the next read.
+		it.data = append(it.data[:0], data...)
+	} else {
+		value, err := f.readElement(current)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.value = value
+	}
+	if current.index < header.tail.index {
+		next, err := f.next(current)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.next = &next
+	} else {
+		it.next = &elementPtr{
+			offset: current.offset + 8 + current.length,
+			length: -1,
+			index:  current.index + 1,
+		}
+	}
+	return true
+}
+
+// Returns the element the iterator is currently at.
+func (it *Iterator) Value() interface{} {
+	return it.value
+}
+
+// Returns the error that stopped the iteration, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
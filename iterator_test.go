@@ -0,0 +1,112 @@
+package eunomia
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestIterator_VisitsElementsWithoutConsuming(t *testing.T) {
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
+
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, queue.Push(MockData{int32(i)}))
+		}
+		_, err := queue.Poll()
+		assert.NoError(t, err)
+
+		it := queue.Iterator()
+		expected := int32(1)
+		for it.Next() {
+			assert.Equal(t, expected, it.Value().(MockData).value)
+			expected++
+		}
+		assert.NoError(t, it.Err())
+		assert.Equal(t, int32(10), expected)
+		assert.Equal(t, int64(9), queue.Size())
+	})
+}
+
+func TestIterator_FollowsPushes(t *testing.T) {
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
+
+		it := queue.Iterator()
+		snapshot := queue.SnapshotIterator()
+		assert.False(t, it.Next())
+
+		assert.NoError(t, queue.Push(MockData{1}))
+		assert.True(t, it.Next())
+		assert.Equal(t, int32(1), it.Value().(MockData).value)
+		assert.NoError(t, queue.Push(MockData{2}))
+		assert.True(t, it.Next())
+		assert.Equal(t, int32(2), it.Value().(MockData).value)
+		assert.False(t, it.Next())
+
+		assert.False(t, snapshot.Next())
+	})
+}
+
+func TestIterator_SkipsPolledElements(t *testing.T) {
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
+
+		assert.NoError(t, queue.Push(MockData{1}))
+		it := queue.Iterator()
+		_, err := queue.Poll()
+		assert.NoError(t, err)
+		assert.NoError(t, queue.Push(MockData{2}))
+
+		assert.True(t, it.Next())
+		assert.Equal(t, int32(2), it.Value().(MockData).value)
+		assert.False(t, it.Next())
+	})
+}
+
+func TestSnapshotIterator_ConcurrentPushes(t *testing.T) {
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
+
+		for i := 0; i < 50; i++ {
+			assert.NoError(t, queue.Push(MockData{int32(i)}))
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 50; i < 100; i++ {
+				assert.NoError(t, queue.Push(MockData{int32(i)}))
+			}
+		}()
+
+		visited := 0
+		queue.All()(func(element interface{}, err error) bool {
+			assert.NoError(t, err)
+			assert.Equal(t, int32(visited), element.(MockData).value)
+			visited++
+			return true
+		})
+		wg.Wait()
+		assert.Equal(t, 50, visited)
+		assert.Equal(t, int64(100), queue.Size())
+	})
+}
+
+func TestSnapshotIterator_SnapshotPolled(t *testing.T) {
+	queue, err := NewStorageQueue(NewMemoryStorage(), &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.NoError(t, queue.Push(MockData{0}))
+	assert.NoError(t, queue.Push(MockData{1}))
+	it := queue.SnapshotIterator()
+
+	// every element of the snapshot is polled, the pushed one is not part of it.
+	for i := 0; i < 2; i++ {
+		_, err := queue.Poll()
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, queue.Push(MockData{99}))
+	assert.False(t, it.Next())
+	assert.NoError(t, it.Err())
+}
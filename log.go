@@ -0,0 +1,415 @@
+package eunomia
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"time"
+)
+
+// Extension of the file storing the committed offsets of the consumers of a FileLog, next to the log file.
+const consumersFileExtension = ".consumers"
+
+// Minimum number of bytes left by the dropped elements before a FileLog reclaims them.
+const defaultLogCompactionThreshold int64 = 64 * 1024
+
+// Describes when the elements of a FileLog can be dropped, an element is dropped as soon as one of the enabled
+// conditions is met. The zero value retains everything.
+type Retention struct {
+	// Drop the elements once every registered consumer has committed past them.
+	UntilConsumed bool
+	// Drop the oldest elements while the elements take more than MaxBytes bytes, 0 means no limit.
+	MaxBytes int64
+	// Drop the elements appended more than MaxAge ago, 0 means no limit.
+	MaxAge time.Duration
+}
+
+// A log backed by a flat file: elements are appended and retained instead of being polled, and any number of named
+// consumers read them at their own pace.
+// Every consumer has a committed offset, persisted next to the log file, from which it resumes after a restart.
+// The log file uses the same format as the FileQueue, every element being prefixed by the time it was appended at.
+//
+// Dropped elements are skipped by the consumers, and the space they used is reclaimed once it's at least as big as
+// the retained elements: the retained elements are moved to the start of the file, and the file is truncated.
+type FileLog struct {
+	filePath   string
+	writer     *QueueProtocolWriter
+	serializer Serializer
+	retention  Retention
+	// committed offsets of the registered consumers.
+	offsets map[string]int64
+	// number of bytes the elements were moved by since the log was opened, the positions of the consumers are kept
+	// relative to the original offsets so that they stay valid when the elements move.
+	reclaimed int64
+	// number of bytes the dropped elements must use before being reclaimed.
+	compactionThreshold int64
+	// the clock the elements are timestamped with, and their age computed from.
+	now func() time.Time
+	mu  sync.Mutex
+}
+
+// A named reader of a FileLog, calling Next does not move the committed offset of the consumer until Commit is called.
+type Consumer struct {
+	log  *FileLog
+	name string
+	// offset of the next element returned by Next, plus the number of bytes reclaimed by the log when it was computed.
+	position int64
+}
+
+// Creates or restores a log from the given file path.
+func NewFileLog(filePath string, serializer Serializer, retention Retention) (*FileLog, error) {
+	file, err := OpenFileStorage(filePath)
+	if err != nil {
+		return nil, err
+	}
+	protoWriter, err := newQueueWriterWithFlags(file, FlagLog)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if protoWriter.header.flags&FlagLog == 0 {
+		file.Close()
+		return nil, ErrIncompatibleFlags
+	}
+	offsets, err := readConsumerOffsets(filePath + consumersFileExtension)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if protoWriter.upgradeShift != 0 && len(offsets) > 0 {
+		// the elements of a legacy log were moved by the upgrade, the committed offsets follow them.
+		for name := range offsets {
+			offsets[name] += protoWriter.upgradeShift
+		}
+		if err := writeConsumerOffsets(filePath+consumersFileExtension, offsets); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return &FileLog{
+		filePath:   filePath,
+		writer:     protoWriter,
+		serializer: serializer,
+		retention:  retention,
+		offsets:    offsets,
+
+		compactionThreshold: defaultLogCompactionThreshold,
+		now:                 time.Now,
+	}, nil
+}
+
+// Appends the element at the end of the log, and drops the elements that are no longer retained.
+func (l *FileLog) Append(element interface{}) error {
+	data := l.serializer.Write(element)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.writer.writable(); err != nil {
+		return err
+	}
+	header := l.writer.header
+	offset := l.end()
+	dataLength := int64(len(data)) + 8
+	if _, err := WriteLong(l.writer.backingFile, offset, dataLength); err != nil {
+		return err
+	}
+	if _, err := WriteLong(l.writer.backingFile, offset+8, l.now().UnixNano()); err != nil {
+		return err
+	}
+	if _, err := WriteChunk(l.writer.backingFile, offset+16, data); err != nil {
+		return err
+	}
+	header.tail = &elementPtr{offset: offset, length: dataLength}
+	if header.elementCount == 0 {
+		header.head = &elementPtr{offset: offset, length: dataLength}
+	}
+	header.elementCount++
+	if err := writeHeader(l.writer.backingFile, header); err != nil {
+		return err
+	}
+	return l.applyRetention()
+}
+
+// Returns the consumer with the given name, registering it if it does not exist yet.
+// A new consumer starts at the oldest retained element.
+func (l *FileLog) Consumer(name string) (*Consumer, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.writer.checkOpen(); err != nil {
+		return nil, err
+	}
+	offset, ok := l.offsets[name]
+	if !ok {
+		offset = l.writer.header.head.offset
+		l.offsets[name] = offset
+		if err := writeConsumerOffsets(l.filePath+consumersFileExtension, l.offsets); err != nil {
+			delete(l.offsets, name)
+			return nil, err
+		}
+	}
+	return &Consumer{
+		log:      l,
+		name:     name,
+		position: offset + l.reclaimed,
+	}, nil
+}
+
+// Returns the number of retained elements.
+func (l *FileLog) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.writer.header.elementCount
+}
+
+// Closes the log, and deletes it's file and the consumer offsets.
+func (l *FileLog) Delete() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.writer.close(); err != nil {
+		return err
+	}
+	if err := os.Remove(l.filePath + consumersFileExtension); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Remove(l.filePath)
+}
+
+// Syncs and closes the log file, every operation on the log and it's consumers fails with ErrQueueClosed afterwards.
+func (l *FileLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.writer.close()
+}
+
+// Returns the next element of the log for this consumer, or EmptyQueueError if the consumer has read every element.
+// If the elements the consumer was at have been dropped by the retention, it continues from the oldest retained one.
+func (c *Consumer) Next() (interface{}, error) {
+	l := c.log
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.writer.checkOpen(); err != nil {
+		return nil, err
+	}
+	position := c.position - l.reclaimed
+	if position < l.writer.header.head.offset {
+		position = l.writer.header.head.offset
+	}
+	if l.writer.header.elementCount == 0 || position >= l.end() {
+		return nil, EmptyQueueError
+	}
+	length, err := ReadLong(l.writer.backingFile, position)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ReadChunk(l.writer.backingFile, position+16, length-8)
+	if err != nil {
+		return nil, err
+	}
+	c.position = position + 8 + length + l.reclaimed
+	return l.serializer.Read(bytes.NewReader(data)), nil
+}
+
+// Persists the position of the consumer, every element returned by Next so far is considered consumed.
+func (c *Consumer) Commit() error {
+	l := c.log
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.writer.writable(); err != nil {
+		return err
+	}
+	previous := l.offsets[c.name]
+	l.offsets[c.name] = c.position - l.reclaimed
+	if err := writeConsumerOffsets(l.filePath+consumersFileExtension, l.offsets); err != nil {
+		l.offsets[c.name] = previous
+		return err
+	}
+	return l.applyRetention()
+}
+
+// Returns the offset right after the last element, where the next element will be appended.
+func (l *FileLog) end() int64 {
+	header := l.writer.header
+	if header.elementCount == 0 {
+		return header.head.offset
+	}
+	return header.tail.offset + 8 + header.tail.length
+}
+
+// Drops the elements at the head of the log that are no longer retained.
+func (l *FileLog) applyRetention() error {
+	header := l.writer.header
+	// elements before minOffset were committed by every consumer.
+	minOffset := header.head.offset
+	if l.retention.UntilConsumed && len(l.offsets) > 0 {
+		minOffset = l.end()
+		for _, offset := range l.offsets {
+			if offset < minOffset {
+				minOffset = offset
+			}
+		}
+	}
+	dropped := false
+	for header.elementCount > 0 {
+		drop := header.head.offset < minOffset
+		if !drop && l.retention.MaxBytes > 0 {
+			drop = l.end()-header.head.offset > l.retention.MaxBytes
+		}
+		if !drop && l.retention.MaxAge > 0 {
+			appendedAt, err := ReadLong(l.writer.backingFile, header.head.offset+8)
+			if err != nil {
+				return err
+			}
+			drop = l.now().Sub(time.Unix(0, appendedAt)) > l.retention.MaxAge
+		}
+		if !drop {
+			break
+		}
+		if err := l.dropHead(); err != nil {
+			return err
+		}
+		dropped = true
+	}
+	if !dropped {
+		return nil
+	}
+	if err := writeHeader(l.writer.backingFile, header); err != nil {
+		return err
+	}
+	return l.compact()
+}
+
+// Moves the retained elements to the start of the file, and truncates the file after them, once the dropped elements
+// use at least as many bytes as the retained ones. The retained elements are copied after the end of the dropped
+// ones, so they are never overwritten before the header points to their new position.
+//
+// The committed offsets are moved before the header: after a crash in between, they point before the head, and the
+// consumers start over from the oldest retained element instead of from the middle of an element.
+func (l *FileLog) compact() error {
+	header := l.writer.header
+	start := dataStart(header.flags)
+	shift := header.head.offset - start
+	live := l.end() - header.head.offset
+	if shift < l.compactionThreshold || shift < live || shift == 0 {
+		return nil
+	}
+	if live > 0 {
+		data, err := ReadChunk(l.writer.backingFile, header.head.offset, live)
+		if err != nil {
+			return err
+		}
+		if _, err := WriteChunk(l.writer.backingFile, start, data); err != nil {
+			return err
+		}
+		if err := l.writer.backingFile.Sync(); err != nil {
+			return err
+		}
+	}
+	if len(l.offsets) > 0 {
+		shifted := make(map[string]int64, len(l.offsets))
+		for name, offset := range l.offsets {
+			if offset -= shift; offset < start {
+				offset = start
+			}
+			shifted[name] = offset
+		}
+		if err := writeConsumerOffsets(l.filePath+consumersFileExtension, shifted); err != nil {
+			return err
+		}
+		l.offsets = shifted
+	}
+	updatedHeader := *header
+	updatedHeader.head = &elementPtr{offset: start, length: header.head.length}
+	updatedHeader.tail = &elementPtr{offset: header.tail.offset - shift, length: header.tail.length}
+	if header.elementCount == 0 {
+		updatedHeader.tail = &elementPtr{offset: start}
+	}
+	if err := writeHeader(l.writer.backingFile, &updatedHeader); err != nil {
+		return err
+	}
+	l.writer.header = &updatedHeader
+	l.reclaimed += shift
+	return l.writer.backingFile.Truncate(start + live)
+}
+
+// Moves the head to the next element, without updating the file header.
+func (l *FileLog) dropHead() error {
+	header := l.writer.header
+	nextOffset := header.head.offset + 8 + header.head.length
+	header.elementCount--
+	if header.elementCount == 0 {
+		header.head = &elementPtr{offset: nextOffset, length: 0}
+		header.tail = &elementPtr{offset: nextOffset, length: 0}
+		return nil
+	}
+	nextLength, err := ReadLong(l.writer.backingFile, nextOffset)
+	if err != nil {
+		return err
+	}
+	header.head = &elementPtr{offset: nextOffset, length: nextLength}
+	return nil
+}
+
+// Reads the consumer offsets file, a missing file means that no consumer was registered yet.
+// The file is a sequence of [name, offset] entries, prefixed by the number of entries.
+func readConsumerOffsets(path string) (map[string]int64, error) {
+	offsets := make(map[string]int64)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return offsets, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	count, err := ReadLong(file, 0)
+	if err != nil {
+		return nil, err
+	}
+	currentOffset := int64(8)
+	for i := int64(0); i < count; i++ {
+		name, err := ReadString(file, currentOffset)
+		if err != nil {
+			return nil, err
+		}
+		currentOffset += 8 + int64(len(name))
+		offset, err := ReadLong(file, currentOffset)
+		if err != nil {
+			return nil, err
+		}
+		currentOffset += 8
+		offsets[name] = offset
+	}
+	return offsets, nil
+}
+
+// Writes the consumer offsets to a temporary file, and renames it over the previous one, so that a crash never leaves
+// a partially written offsets file behind.
+func writeConsumerOffsets(path string, offsets map[string]int64) error {
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	currentOffset, err := WriteLong(file, 0, int64(len(offsets)))
+	if err != nil {
+		file.Close()
+		return err
+	}
+	for name, offset := range offsets {
+		if currentOffset, err = WriteString(file, currentOffset, name); err != nil {
+			file.Close()
+			return err
+		}
+		if currentOffset, err = WriteLong(file, currentOffset, offset); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,184 @@
+package eunomia
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFileLog_IndependentConsumers(t *testing.T) {
+	log, err := NewFileLog("some-log", &MockDataSerializer{}, Retention{})
+	assert.NoError(t, err)
+	defer log.Delete()
+
+	billing, err := log.Consumer("billing")
+	assert.NoError(t, err)
+	audit, err := log.Consumer("audit")
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, log.Append(MockData{int32(i)}))
+	}
+	for i := 0; i < 3; i++ {
+		el, err := billing.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, int32(i), el.(MockData).value)
+	}
+	_, err = billing.Next()
+	assert.Same(t, EmptyQueueError, err)
+
+	el, err := audit.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), el.(MockData).value)
+	assert.Equal(t, int64(3), log.Size())
+}
+
+func TestFileLog_CommittedOffsetsSurviveRestart(t *testing.T) {
+	log, err := NewFileLog("some-log", &MockDataSerializer{}, Retention{})
+	assert.NoError(t, err)
+	defer log.Delete()
+
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, log.Append(MockData{int32(i)}))
+	}
+	consumer, err := log.Consumer("billing")
+	assert.NoError(t, err)
+	_, err = consumer.Next()
+	assert.NoError(t, err)
+	assert.NoError(t, consumer.Commit())
+	// read but not committed.
+	_, err = consumer.Next()
+	assert.NoError(t, err)
+
+	restored, err := NewFileLog("some-log", &MockDataSerializer{}, Retention{})
+	assert.NoError(t, err)
+	consumer, err = restored.Consumer("billing")
+	assert.NoError(t, err)
+	el, err := consumer.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), el.(MockData).value)
+}
+
+func TestFileLog_RetentionUntilConsumed(t *testing.T) {
+	log, err := NewFileLog("some-log", &MockDataSerializer{}, Retention{UntilConsumed: true})
+	assert.NoError(t, err)
+	defer log.Delete()
+
+	fast, err := log.Consumer("fast")
+	assert.NoError(t, err)
+	slow, err := log.Consumer("slow")
+	assert.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, log.Append(MockData{int32(i)}))
+	}
+
+	for i := 0; i < 4; i++ {
+		_, err = fast.Next()
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, fast.Commit())
+	assert.Equal(t, int64(4), log.Size())
+
+	_, err = slow.Next()
+	assert.NoError(t, err)
+	_, err = slow.Next()
+	assert.NoError(t, err)
+	assert.NoError(t, slow.Commit())
+	assert.Equal(t, int64(2), log.Size())
+}
+
+func TestFileLog_RetentionBySizeAndAge(t *testing.T) {
+	log, err := NewFileLog("some-log", &MockDataSerializer{}, Retention{MaxBytes: 40})
+	assert.NoError(t, err)
+	defer log.Delete()
+
+	consumer, err := log.Consumer("late")
+	assert.NoError(t, err)
+	// every element takes 20 bytes: length, timestamp and 4 bytes of data.
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, log.Append(MockData{int32(i)}))
+	}
+	assert.Equal(t, int64(2), log.Size())
+	el, err := consumer.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), el.(MockData).value)
+
+	aged, err := NewFileLog("some-log", &MockDataSerializer{}, Retention{MaxAge: time.Minute})
+	assert.NoError(t, err)
+	// the retained elements were appended with the real clock.
+	now := time.Now().Add(2 * time.Minute)
+	aged.now = func() time.Time { return now }
+	assert.NoError(t, aged.Append(MockData{5}))
+	assert.Equal(t, int64(1), aged.Size())
+}
+
+func TestFileLog_Close(t *testing.T) {
+	log, err := NewFileLog("some-log", &MockDataSerializer{}, Retention{})
+	assert.NoError(t, err)
+	defer log.Delete()
+	assert.NoError(t, log.Append(MockData{1}))
+	consumer, err := log.Consumer("billing")
+	assert.NoError(t, err)
+	assert.NoError(t, log.Close())
+
+	assert.Same(t, ErrQueueClosed, log.Append(MockData{2}))
+	_, err = consumer.Next()
+	assert.Same(t, ErrQueueClosed, err)
+	assert.Same(t, ErrQueueClosed, consumer.Commit())
+	_, err = log.Consumer("audit")
+	assert.Same(t, ErrQueueClosed, err)
+}
+
+func TestFileLog_ReclaimsDroppedElements(t *testing.T) {
+	log, err := NewFileLog("some-log", &MockDataSerializer{}, Retention{MaxBytes: 40})
+	assert.NoError(t, err)
+	defer log.Delete()
+	log.compactionThreshold = 0
+
+	consumer, err := log.Consumer("billing")
+	assert.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, log.Append(MockData{int32(i)}))
+		if i == 97 {
+			el, err := consumer.Next()
+			assert.NoError(t, err)
+			assert.Equal(t, int32(96), el.(MockData).value)
+			assert.NoError(t, consumer.Commit())
+		}
+	}
+	size, err := log.writer.backingFile.Size()
+	assert.NoError(t, err)
+	// the dropped elements never use more bytes than the two retained ones.
+	assert.True(t, size <= headerSize+4*20, "the log file takes %d bytes", size)
+	assert.True(t, log.reclaimed > 0)
+
+	// the position of the consumer follows the moved elements.
+	el, err := consumer.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(98), el.(MockData).value)
+
+	restored, err := NewFileLog("some-log", &MockDataSerializer{}, Retention{MaxBytes: 40})
+	assert.NoError(t, err)
+	consumer, err = restored.Consumer("billing")
+	assert.NoError(t, err)
+	el, err = consumer.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(98), el.(MockData).value)
+
+	stat, err := os.Stat("some-log" + consumersFileExtension)
+	assert.NoError(t, err)
+	// the offsets file is not executable.
+	assert.Equal(t, os.FileMode(0), stat.Mode().Perm()&0111)
+}
+
+func TestFileLog_RejectsQueueFile(t *testing.T) {
+	queue, err := NewFileQueue("some-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer queue.Delete()
+
+	opened := openFiles(t)
+	_, err = NewFileLog("some-queue", &MockDataSerializer{}, Retention{})
+	assert.Same(t, ErrIncompatibleFlags, err)
+	assert.Equal(t, opened, openFiles(t))
+}
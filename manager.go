@@ -0,0 +1,187 @@
+package eunomia
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Extension of the queue files of a Manager, the name of a queue is the name of it's file without the extension.
+const queueExtension = ".queue"
+
+var (
+	ErrInvalidQueueName   = errors.New("the queue name must be non empty, and cannot contain path separators")
+	ErrQueueExists        = errors.New("a queue with the same name already exists")
+	ErrQueueNotFound      = errors.New("no queue with the given name")
+	ErrManagerClosed      = errors.New("the manager is closed")
+	ErrSerializerMismatch = errors.New("the queue is already open with a serializer of another type")
+)
+
+// Opens the queues stored in a directory by name, every queue being stored in it's own `<dir>/<name>.queue` file.
+// The opened queues are cached, so opening a queue twice returns the same handle, and it's safe to use a Manager
+// from multiple goroutines.
+type Manager struct {
+	dirPath string
+	queues  map[string]*FileQueue
+	closed  bool
+	mu      sync.Mutex
+}
+
+// Creates a manager for the queues of the given directory, the directory is created if needed.
+func NewManager(dirPath string) (*Manager, error) {
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		return nil, err
+	}
+	return &Manager{
+		dirPath: dirPath,
+		queues:  make(map[string]*FileQueue),
+	}, nil
+}
+
+// Returns the queue with the given name, creating it if it does not exist (unless WithMustExist is given).
+// The options are only used the first time the queue is opened, the next calls return the cached handle, or fail
+// with ErrSerializerMismatch if the serializer is of another type. A handle closed or deleted directly is not
+// returned, the queue is opened again.
+func (m *Manager) Open(name string, serializer Serializer, opts ...Option) (*FileQueue, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrManagerClosed
+	}
+	if queue, ok := m.queues[name]; ok {
+		queue.mu.Lock()
+		err := queue.writer.checkOpen()
+		queue.mu.Unlock()
+		if err == nil {
+			if reflect.TypeOf(queue.serializer) != reflect.TypeOf(serializer) {
+				return nil, ErrSerializerMismatch
+			}
+			return queue, nil
+		}
+		delete(m.queues, name)
+	}
+	path, err := m.path(name)
+	if err != nil {
+		return nil, err
+	}
+	queue, err := OpenFileQueue(path, serializer, opts...)
+	if err != nil {
+		return nil, err
+	}
+	m.queues[name] = queue
+	return queue, nil
+}
+
+// Returns the names of the queues of the directory, opened or not, in alphabetical order.
+func (m *Manager) List() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrManagerClosed
+	}
+	entries, err := ioutil.ReadDir(m.dirPath)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), queueExtension) {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(entry.Name(), queueExtension))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Deletes the queue with the given name, and releases it's handle if it's open.
+func (m *Manager) Delete(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrManagerClosed
+	}
+	path, err := m.path(name)
+	if err != nil {
+		return err
+	}
+	if queue, ok := m.queues[name]; ok {
+		delete(m.queues, name)
+		if err := queue.Close(); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return ErrQueueNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Renames the queue, the handle of an open queue stays valid and is cached under the new name.
+// Fails with ErrQueueExists if a queue already has the new name.
+func (m *Manager) Rename(oldName, newName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrManagerClosed
+	}
+	oldPath, err := m.path(oldName)
+	if err != nil {
+		return err
+	}
+	newPath, err := m.path(newName)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(oldPath); os.IsNotExist(err) {
+		return ErrQueueNotFound
+	}
+	if _, err := os.Stat(newPath); err == nil {
+		return ErrQueueExists
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	if queue, ok := m.queues[oldName]; ok {
+		delete(m.queues, oldName)
+		queue.mu.Lock()
+		queue.filePath = newPath
+		queue.mu.Unlock()
+		m.queues[newName] = queue
+	}
+	return nil
+}
+
+// Closes every open queue, the manager and it's queues cannot be used afterwards.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	var firstErr error
+	for name, queue := range m.queues {
+		delete(m.queues, name)
+		if err := queue.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Returns the path of the file of the queue with the given name.
+func (m *Manager) path(name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", ErrInvalidQueueName
+	}
+	return filepath.Join(m.dirPath, name+queueExtension), nil
+}
@@ -0,0 +1,110 @@
+package eunomia
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager_OpenAndList(t *testing.T) {
+	defer os.RemoveAll("managed-queues")
+	manager, err := NewManager("managed-queues")
+	assert.NoError(t, err)
+
+	orders, err := manager.Open("orders", &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.NoError(t, orders.Push(MockData{1}))
+	same, err := manager.Open("orders", &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.Same(t, orders, same)
+
+	emails, err := manager.Open("emails", &MockDataSerializer{}, WithCapacity(Capacity{MaxElements: 1}), WithDurability(DurabilitySync))
+	assert.NoError(t, err)
+	assert.NoError(t, emails.Push(MockData{2}))
+	assert.Equal(t, ErrQueueFull, emails.Push(MockData{3}))
+
+	names, err := manager.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"emails", "orders"}, names)
+
+	_, err = manager.Open("../escape", &MockDataSerializer{})
+	assert.Equal(t, ErrInvalidQueueName, err)
+	_, err = manager.Open("", &MockDataSerializer{})
+	assert.Equal(t, ErrInvalidQueueName, err)
+
+	assert.NoError(t, manager.Close())
+	_, err = manager.Open("orders", &MockDataSerializer{})
+	assert.Equal(t, ErrManagerClosed, err)
+
+	// the queues are restored by a new manager.
+	manager, err = NewManager("managed-queues")
+	assert.NoError(t, err)
+	defer manager.Close()
+	orders, err = manager.Open("orders", &MockDataSerializer{})
+	assert.NoError(t, err)
+	el, err := orders.Poll()
+	assert.NoError(t, err)
+	assert.Equal(t, MockData{1}, el)
+}
+
+func TestManager_DeleteAndRename(t *testing.T) {
+	defer os.RemoveAll("managed-queues")
+	manager, err := NewManager("managed-queues")
+	assert.NoError(t, err)
+	defer manager.Close()
+
+	queue, err := manager.Open("a", &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.NoError(t, queue.Push(MockData{1}))
+	_, err = manager.Open("b", &MockDataSerializer{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, ErrQueueExists, manager.Rename("a", "b"))
+	assert.Equal(t, ErrQueueNotFound, manager.Rename("missing", "c"))
+	assert.NoError(t, manager.Rename("a", "c"))
+	renamed, err := manager.Open("c", &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.Same(t, queue, renamed)
+	assert.NoError(t, renamed.Push(MockData{2}))
+	assert.Equal(t, int64(2), renamed.Size())
+
+	assert.NoError(t, manager.Delete("b"))
+	assert.Equal(t, ErrQueueNotFound, manager.Delete("b"))
+	names, err := manager.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c"}, names)
+
+	// a deleted queue is recreated empty.
+	assert.NoError(t, manager.Delete("c"))
+	queue, err = manager.Open("c", &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), queue.Size())
+}
+
+func TestManager_OpenClosedOrMismatched(t *testing.T) {
+	defer os.RemoveAll("managed-queues")
+	manager, err := NewManager("managed-queues")
+	assert.NoError(t, err)
+	defer manager.Close()
+
+	queue, err := manager.Open("a", &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.NoError(t, queue.Push(MockData{1}))
+	_, err = manager.Open("a", &JSONMockDataSerializer{})
+	assert.Equal(t, ErrSerializerMismatch, err)
+
+	// a handle closed directly is replaced.
+	assert.NoError(t, queue.Close())
+	reopened, err := manager.Open("a", &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.NotSame(t, queue, reopened)
+	assert.Equal(t, int64(1), reopened.Size())
+
+	// a handle deleted directly is replaced by an empty queue.
+	assert.NoError(t, reopened.Delete())
+	recreated, err := manager.Open("a", &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.NotSame(t, reopened, recreated)
+	assert.Equal(t, int64(0), recreated.Size())
+}
@@ -0,0 +1,170 @@
+package eunomia
+
+import (
+	"bytes"
+	"sync"
+)
+
+// An in-memory implementation of the IndexedQueue interface, with the same semantics as the FileQueue.
+// Elements go through the serializer like they would with a FileQueue, so the polled elements are copies of the
+// pushed ones, which makes it a drop-in replacement for tests and ephemeral environments.
+type MemoryQueue struct {
+	serializer Serializer
+	// serialized elements, the head first.
+	elements [][]byte
+	closed   bool
+	mu       sync.Mutex
+}
+
+func NewMemoryQueue(serializer Serializer) *MemoryQueue {
+	return &MemoryQueue{serializer: serializer}
+}
+
+func (m *MemoryQueue) Push(element interface{}) error {
+	data := m.serializer.Write(element)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrQueueClosed
+	}
+	m.elements = append(m.elements, data)
+	return nil
+}
+
+func (m *MemoryQueue) Poll() (interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrQueueClosed
+	}
+	if len(m.elements) == 0 {
+		return nil, EmptyQueueError
+	}
+	data := m.elements[0]
+	m.elements[0] = nil
+	m.elements = m.elements[1:]
+	return m.serializer.Read(bytes.NewReader(data)), nil
+}
+
+func (m *MemoryQueue) Peek() (interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrQueueClosed
+	}
+	if len(m.elements) == 0 {
+		return nil, EmptyQueueError
+	}
+	return m.serializer.Read(bytes.NewReader(m.elements[0])), nil
+}
+
+func (m *MemoryQueue) Size() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(len(m.elements))
+}
+
+// Drops every element of the queue, and closes it.
+func (m *MemoryQueue) Delete() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.elements = nil
+	m.closed = true
+	return nil
+}
+
+// Every operation on the queue fails with ErrQueueClosed once it's closed, the elements are kept until the queue is
+// garbage collected.
+func (m *MemoryQueue) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+func (m *MemoryQueue) Get(i int64) (interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrQueueClosed
+	}
+	if i < 0 || i >= int64(len(m.elements)) {
+		return nil, ErrIndexOutOfBounds
+	}
+	return m.serializer.Read(bytes.NewReader(m.elements[i])), nil
+}
+
+// Returns a sequence over the elements present in the queue when the iteration starts.
+func (m *MemoryQueue) All() func(yield func(interface{}, error) bool) {
+	return func(yield func(interface{}, error) bool) {
+		m.mu.Lock()
+		closed := m.closed
+		elements := append([][]byte(nil), m.elements...)
+		m.mu.Unlock()
+		if closed {
+			yield(nil, ErrQueueClosed)
+			return
+		}
+		for _, data := range elements {
+			if !yield(m.serializer.Read(bytes.NewReader(data)), nil) {
+				return
+			}
+		}
+	}
+}
+
+func (m *MemoryQueue) elementSerializer() Serializer {
+	return m.serializer
+}
+
+func (m *MemoryQueue) rawElements(visit func(data []byte) bool) error {
+	m.mu.Lock()
+	closed := m.closed
+	elements := append([][]byte(nil), m.elements...)
+	m.mu.Unlock()
+	if closed {
+		return ErrQueueClosed
+	}
+	for _, data := range elements {
+		if !visit(data) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m *MemoryQueue) RemoveIf(predicate func(interface{}) bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return 0, ErrQueueClosed
+	}
+	removed := 0
+	kept := make([][]byte, 0, len(m.elements))
+	for _, data := range m.elements {
+		if predicate(m.serializer.Read(bytes.NewReader(data))) {
+			removed++
+			continue
+		}
+		kept = append(kept, data)
+	}
+	m.elements = kept
+	return removed, nil
+}
+
+func (m *MemoryQueue) ReplaceIf(predicate func(interface{}) bool, replacement func(interface{}) interface{}) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return 0, ErrQueueClosed
+	}
+	replaced := 0
+	for i, data := range m.elements {
+		element := m.serializer.Read(bytes.NewReader(data))
+		if predicate(element) {
+			m.elements[i] = m.serializer.Write(replacement(element))
+			replaced++
+		}
+	}
+	return replaced, nil
+}
@@ -0,0 +1,162 @@
+package eunomia
+
+import "errors"
+
+var ErrUnsupportedVersion = errors.New("the file was written with a format version that is not supported")
+
+// A version of the file format: how to read the header of it's files, and how to upgrade them to the next version.
+type formatVersion struct {
+	readHeader func(file Storage) (*header, error)
+	// upgrades the file in place, returns the number of bytes the elements were moved by, nil for the current version.
+	upgrade func(file Storage) (int64, error)
+}
+
+// The versions of the format this library can read.
+// The high bits of a version (version >> 8) are it's major version and the low byte it's minor version. The files of an
+// older version are upgraded step by step when opened, the files of a newer minor version of the current major are
+// opened read-only (the fields they added to the header are ignored), and any other version is unsupported.
+var formatVersions = map[int32]formatVersion{
+	legacyVersionNumber: {readHeader: readLegacyHeader, upgrade: upgradeLegacyFile},
+	MagicVersionNumber:  {readHeader: checkCorrupt},
+}
+
+// Returns true if the files written with the given version can be read with the current format.
+func readableVersion(version int32) bool {
+	return version>>8 == MagicVersionNumber>>8 && version >= MagicVersionNumber
+}
+
+// Reads the header of the file, after upgrading it to the current version if it was written with an older one.
+func (w *QueueProtocolWriter) open() error {
+	version, err := ReadInt(w.backingFile, 0)
+	if err != nil {
+		return err
+	}
+	if version>>8 != MagicVersionNumber>>8 {
+		return ErrUnsupportedVersion
+	}
+	for version < MagicVersionNumber {
+		format, ok := formatVersions[version]
+		if !ok {
+			return ErrUnsupportedVersion
+		}
+		shift, err := format.upgrade(w.backingFile)
+		if err != nil {
+			return err
+		}
+		w.upgradeShift += shift
+		if version, err = ReadInt(w.backingFile, 0); err != nil {
+			return err
+		}
+	}
+	header, err := formatVersions[MagicVersionNumber].readHeader(w.backingFile)
+	if err != nil {
+		return err
+	}
+	w.header = header
+	w.readOnly = version > MagicVersionNumber
+	return nil
+}
+
+// Returns ErrUnsupportedVersion if the file was written by a newer version, and cannot be modified, a *ReadOnlyError
+// if it was opened read-only, or ErrQueueClosed if it's closed.
+func (w *QueueProtocolWriter) writable() error {
+	if err := w.checkOpen(); err != nil {
+		return err
+	}
+	if w.openedReadOnly {
+		return &ReadOnlyError{}
+	}
+	if w.readOnly {
+		return ErrUnsupportedVersion
+	}
+	return nil
+}
+
+// Upgrades a file written with the legacy format (version 0x23) to the current one.
+// The legacy header is 16 bytes smaller, if the polled space before the head is not enough to grow the header, the
+// live elements are copied past their current end first, so the old copy stays valid until the new header is written.
+// Returns the number of bytes the elements were moved by.
+func upgradeLegacyFile(file Storage) (int64, error) {
+	header, err := readLegacyHeader(file)
+	if err != nil {
+		return 0, err
+	}
+	frameSize := int64(8)
+	if header.flags&FlagTrailingLength != 0 {
+		frameSize = 16
+	}
+	liveStart := header.head.offset
+	liveEnd := liveStart
+	if header.elementCount > 0 {
+		tailLength, err := ReadLong(file, header.tail.offset)
+		if err != nil {
+			return 0, err
+		}
+		liveEnd = header.tail.offset + frameSize + tailLength
+	}
+	newStart := liveStart
+	if liveStart < dataStart(header.flags) {
+		newStart = liveEnd
+		if newStart < dataStart(header.flags) {
+			newStart = dataStart(header.flags)
+		}
+		if liveEnd > liveStart {
+			live, err := ReadChunk(file, liveStart, liveEnd-liveStart)
+			if err != nil {
+				return 0, err
+			}
+			if _, err := WriteChunk(file, newStart, live); err != nil {
+				return 0, err
+			}
+		}
+	}
+	shift := newStart - liveStart
+	header.version = MagicVersionNumber
+	header.head.offset += shift
+	header.tail.offset += shift
+	if err := writeHeader(file, header); err != nil {
+		return 0, err
+	}
+	return shift, file.Sync()
+}
+
+// Reads the header of a legacy file, laid out as [version, flags, elementCount, headOffset, tailOffset] followed by
+// the capacity limits of the bounded queues.
+func readLegacyHeader(file Storage) (*header, error) {
+	header := &header{head: &elementPtr{}, tail: &elementPtr{}}
+	var err error
+	if header.version, err = ReadInt(file, 0); err != nil {
+		return nil, err
+	}
+	if header.flags, err = ReadInt(file, 4); err != nil {
+		return nil, err
+	}
+	if header.elementCount, err = ReadLong(file, 8); err != nil {
+		return nil, err
+	}
+	if header.head.offset, err = ReadLong(file, 16); err != nil {
+		return nil, err
+	}
+	if header.tail.offset, err = ReadLong(file, 24); err != nil {
+		return nil, err
+	}
+	if header.flags&FlagBounded != 0 {
+		if header.maxElements, err = ReadLong(file, legacyHeaderSize); err != nil {
+			return nil, err
+		}
+		if header.maxBytes, err = ReadLong(file, legacyHeaderSize+8); err != nil {
+			return nil, err
+		}
+	}
+	if header.elementCount > 0 {
+		header.tail.index = header.elementCount - 1
+		// like checkCorrupt, the lengths are left to 0 if the elements are cut by the end of the file.
+		if headLength, err := ReadLong(file, header.head.offset); err == nil {
+			header.head.length = headLength
+		}
+		if tailLength, err := ReadLong(file, header.tail.offset); err == nil {
+			header.tail.length = tailLength
+		}
+	}
+	return header, nil
+}
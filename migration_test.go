@@ -0,0 +1,208 @@
+package eunomia
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+// Writes a file in the legacy format, with the given elements already framed, starting at the given offset.
+func writeLegacyFile(t *testing.T, path string, flags int32, start int64, frames [][]byte, tailOffset int64) {
+	file, err := OpenFileStorage(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	_, err = WriteInt(file, 0, legacyVersionNumber)
+	assert.NoError(t, err)
+	_, err = WriteInt(file, 4, flags)
+	assert.NoError(t, err)
+	_, err = WriteLong(file, 8, int64(len(frames)))
+	assert.NoError(t, err)
+	_, err = WriteLong(file, 16, start)
+	assert.NoError(t, err)
+	_, err = WriteLong(file, 24, tailOffset)
+	assert.NoError(t, err)
+	offset := start
+	for _, frame := range frames {
+		_, err = WriteChunk(file, offset, frame)
+		assert.NoError(t, err)
+		offset += int64(len(frame))
+	}
+}
+
+func legacyFrames(values ...int32) ([][]byte, int64) {
+	frames := make([][]byte, 0)
+	tail := legacyHeaderSize
+	for i, value := range values {
+		frames = append(frames, append(toBytes64(4), toBytes(value)...))
+		if i > 0 {
+			tail += 12
+		}
+	}
+	return frames, tail
+}
+
+func TestUpgradeLegacyFile_Queue(t *testing.T) {
+	frames, tail := legacyFrames(1, 2, 3)
+	writeLegacyFile(t, "legacy-queue", 0, legacyHeaderSize, frames, tail)
+
+	queue, err := NewFileQueue("legacy-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer queue.Delete()
+	info, err := queue.(*FileQueue).Info()
+	assert.NoError(t, err)
+	assert.Equal(t, MagicVersionNumber, info.Version)
+	assert.True(t, info.CreatedAt.IsZero())
+	assert.Equal(t, int64(36), info.Bytes)
+	assert.NoError(t, queue.Push(MockData{4}))
+
+	restored, err := NewFileQueue("legacy-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	for i := int32(1); i <= 4; i++ {
+		el, err := restored.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, MockData{i}, el)
+	}
+}
+
+func TestUpgradeLegacyFile_ReusesPolledSpace(t *testing.T) {
+	// the first two elements were polled, the head is far enough from the start of the file to grow the header.
+	frames, _ := legacyFrames(3)
+	writeLegacyFile(t, "legacy-queue", 0, legacyHeaderSize+24, frames, legacyHeaderSize+24)
+
+	queue, err := NewFileQueue("legacy-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer queue.Delete()
+	assert.Equal(t, legacyHeaderSize+24, queue.(*FileQueue).writer.header.head.offset)
+	el, err := queue.Poll()
+	assert.NoError(t, err)
+	assert.Equal(t, MockData{3}, el)
+}
+
+func TestUpgradeLegacyFile_Bounded(t *testing.T) {
+	frames, tail := legacyFrames(1, 2)
+	writeLegacyFile(t, "legacy-queue", FlagBounded, legacyHeaderSize+capacitySize, frames, tail+capacitySize)
+	file, err := OpenFileStorage("legacy-queue")
+	assert.NoError(t, err)
+	_, err = WriteLong(file, legacyHeaderSize, 2)
+	assert.NoError(t, err)
+	_, err = WriteLong(file, legacyHeaderSize+8, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	queue, err := NewFileQueue("legacy-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer queue.Delete()
+	assert.Equal(t, Capacity{MaxElements: 2}, queue.(*FileQueue).Capacity())
+	assert.Same(t, ErrQueueFull, queue.Push(MockData{3}))
+	el, err := queue.Peek()
+	assert.NoError(t, err)
+	assert.Equal(t, MockData{1}, el)
+}
+
+func TestUpgradeLegacyFile_Deque(t *testing.T) {
+	frames := [][]byte{
+		append(append(toBytes64(4), toBytes(1)...), toBytes64(4)...),
+		append(append(toBytes64(4), toBytes(2)...), toBytes64(4)...),
+	}
+	writeLegacyFile(t, "legacy-deque", FlagTrailingLength, legacyHeaderSize, frames, legacyHeaderSize+20)
+
+	deque, err := NewFileDeque("legacy-deque", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer deque.Delete()
+	el, err := deque.PollBack()
+	assert.NoError(t, err)
+	assert.Equal(t, MockData{2}, el)
+	el, err = deque.PollBack()
+	assert.NoError(t, err)
+	assert.Equal(t, MockData{1}, el)
+}
+
+func TestUpgradeLegacyFile_LogMovesConsumerOffsets(t *testing.T) {
+	frames := [][]byte{
+		append(append(toBytes64(12), toBytes64(0)...), toBytes(1)...),
+		append(append(toBytes64(12), toBytes64(0)...), toBytes(2)...),
+	}
+	writeLegacyFile(t, "legacy-log", FlagLog, legacyHeaderSize, frames, legacyHeaderSize+20)
+	// the consumer committed the first element.
+	assert.NoError(t, writeConsumerOffsets("legacy-log"+consumersFileExtension, map[string]int64{"consumer": legacyHeaderSize + 20}))
+	defer os.Remove("legacy-log" + consumersFileExtension)
+
+	log, err := NewFileLog("legacy-log", &MockDataSerializer{}, Retention{})
+	assert.NoError(t, err)
+	defer log.Delete()
+	consumer, err := log.Consumer("consumer")
+	assert.NoError(t, err)
+	el, err := consumer.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, MockData{2}, el)
+}
+
+func TestOpen_NewerMinorVersionIsReadOnly(t *testing.T) {
+	queue, err := NewFileQueue("newer-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer queue.Delete()
+	assert.NoError(t, queue.Push(MockData{1}))
+	assert.NoError(t, queue.Push(MockData{2}))
+	_, err = WriteInt(queue.(*FileQueue).writer.backingFile, 0, MagicVersionNumber+1)
+	assert.NoError(t, err)
+
+	newer, err := NewFileQueue("newer-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), newer.Size())
+	el, err := newer.Peek()
+	assert.NoError(t, err)
+	assert.Equal(t, MockData{1}, el)
+	el, err = newer.(*FileQueue).Get(1)
+	assert.NoError(t, err)
+	assert.Equal(t, MockData{2}, el)
+
+	assert.Same(t, ErrUnsupportedVersion, newer.Push(MockData{3}))
+	_, err = newer.Poll()
+	assert.Same(t, ErrUnsupportedVersion, err)
+	_, err = newer.(*FileQueue).RemoveIf(func(el interface{}) bool {
+		return true
+	})
+	assert.Same(t, ErrUnsupportedVersion, err)
+	assert.Equal(t, int64(2), newer.Size())
+}
+
+func TestOpen_UnsupportedVersions(t *testing.T) {
+	for _, version := range []int32{MagicVersionNumber + 0x100, 0x10} {
+		storage := NewMemoryStorage()
+		_, err := WriteInt(storage, 0, version)
+		assert.NoError(t, err)
+		_, err = NewStorageQueue(storage, &MockDataSerializer{})
+		assert.Same(t, ErrUnsupportedVersion, err)
+	}
+}
+
+func TestOpen_UpgradesStepByStep(t *testing.T) {
+	// a made up version before the legacy one, which only differs by it's version number.
+	formatVersions[0x22] = formatVersion{
+		readHeader: readLegacyHeader,
+		upgrade: func(file Storage) (int64, error) {
+			_, err := WriteInt(file, 0, legacyVersionNumber)
+			return 0, err
+		},
+	}
+	defer delete(formatVersions, 0x22)
+	frames, tail := legacyFrames(1, 2)
+	writeLegacyFile(t, "legacy-queue", 0, legacyHeaderSize, frames, tail)
+	file, err := OpenFileStorage("legacy-queue")
+	assert.NoError(t, err)
+	_, err = WriteInt(file, 0, 0x22)
+	assert.NoError(t, err)
+
+	defer os.Remove("legacy-queue")
+	defer file.Close()
+	queue, err := NewStorageQueue(file, &MockDataSerializer{})
+	assert.NoError(t, err)
+	info, err := queue.Info()
+	assert.NoError(t, err)
+	assert.Equal(t, MagicVersionNumber, info.Version)
+	for i := int32(1); i <= 2; i++ {
+		el, err := queue.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, MockData{i}, el)
+	}
+}
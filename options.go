@@ -0,0 +1,142 @@
+package eunomia
+
+import (
+	"compress/flate"
+	"os"
+)
+
+// Configures a queue when it's opened, see the With functions.
+type Option func(*options)
+
+type options struct {
+	// permissions of the queue file when it's created.
+	mode os.FileMode
+	// fail if the file does not exist, instead of creating it.
+	mustExist  bool
+	readOnly   bool
+	durability Durability
+	// nil for an unbounded queue.
+	capacity         *Capacity
+	checksums        bool
+	compression      bool
+	compressionLevel int
+	recovery         recoveryOptions
+	readAheadSize    int64
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		mode:             0755,
+		recovery:         defaultRecovery,
+		compressionLevel: flate.DefaultCompression,
+		readAheadSize:    defaultReadAheadSize,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Returns the flags of a file created with the options.
+func (o *options) flags() int32 {
+	flags := int32(0)
+	if o.capacity != nil {
+		flags |= FlagBounded
+	}
+	if o.checksums {
+		flags |= FlagChecksum
+	}
+	if o.compression {
+		flags |= FlagCompressed
+	}
+	return flags
+}
+
+// Opens the file of the queue according to the options.
+func (o *options) openStorage(filePath string) (*FileStorage, error) {
+	flag := os.O_CREATE | os.O_RDWR
+	if o.readOnly {
+		flag = os.O_RDONLY
+	} else if o.mustExist {
+		flag = os.O_RDWR
+	}
+	file, err := os.OpenFile(filePath, flag, o.mode)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStorage{file}, nil
+}
+
+// Sets the permissions of the queue file when it's created, 0755 by default.
+func WithFileMode(mode os.FileMode) Option {
+	return func(o *options) {
+		o.mode = mode
+	}
+}
+
+// Fails to open the queue if it's file does not exist, instead of creating a new queue.
+func WithMustExist() Option {
+	return func(o *options) {
+		o.mustExist = true
+	}
+}
+
+// Opens the file read-only, every operation modifying the queue fails with a *ReadOnlyError, see OpenReadOnly.
+// The file must exist, and be written with the current version of the format.
+func WithReadOnly() Option {
+	return func(o *options) {
+		o.readOnly = true
+	}
+}
+
+// Sets the durability policy of the queue, see SetDurability.
+func WithDurability(durability Durability) Option {
+	return func(o *options) {
+		o.durability = durability
+	}
+}
+
+// Opens the queue as a bounded queue, see NewBoundedFileQueue.
+func WithCapacity(capacity Capacity) Option {
+	return func(o *options) {
+		o.capacity = &capacity
+	}
+}
+
+// Stores a CRC32 checksum with every element, reading an element whose data does not match it's checksum fails
+// with ErrChecksumMismatch. Checksums are enabled when the file is created, and kept by the next opens.
+func WithChecksums() Option {
+	return func(o *options) {
+		o.checksums = true
+	}
+}
+
+// Compresses every element with flate at the given level (flate.DefaultCompression, flate.BestSpeed ...).
+// Compression is enabled when the file is created, and kept by the next opens.
+func WithCompression(level int) Option {
+	return func(o *options) {
+		o.compression = true
+		o.compressionLevel = level
+	}
+}
+
+// Sets what to do with a torn tail when the queue is opened, RecoverAuto by default.
+func WithRecovery(policy RecoveryPolicy) Option {
+	return func(o *options) {
+		o.recovery.policy = policy
+	}
+}
+
+// Sets where the queue logs, the standard logger by default.
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		o.recovery.logger = logger
+	}
+}
+
+// Sets the size of the blocks read ahead of the polled elements, see SetReadAheadSize.
+func WithReadAheadSize(size int64) Option {
+	return func(o *options) {
+		o.readAheadSize = size
+	}
+}
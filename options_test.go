@@ -0,0 +1,76 @@
+package eunomia
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptions_FileModeAndMustExist(t *testing.T) {
+	defer os.Remove("options-queue")
+	_, err := OpenFileQueue("options-queue", &MockDataSerializer{}, WithMustExist())
+	assert.True(t, os.IsNotExist(err))
+
+	queue, err := NewFileQueue("options-queue", &MockDataSerializer{}, WithFileMode(0600))
+	assert.NoError(t, err)
+	assert.NoError(t, queue.Push(MockData{1}))
+	assert.NoError(t, queue.Close())
+	info, err := os.Stat("options-queue")
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	restored, err := OpenFileQueue("options-queue", &MockDataSerializer{}, WithMustExist())
+	assert.NoError(t, err)
+	defer restored.Close()
+	assert.Equal(t, int64(1), restored.Size())
+}
+
+func TestOptions_ReadOnly(t *testing.T) {
+	defer os.Remove("options-queue")
+	_, err := OpenFileQueue("options-queue", &MockDataSerializer{}, WithReadOnly())
+	assert.True(t, os.IsNotExist(err))
+
+	queue, err := OpenFileQueue("options-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.NoError(t, queue.Push(MockData{1}))
+	assert.NoError(t, queue.Push(MockData{2}))
+
+	readOnly, err := OpenFileQueue("options-queue", &MockDataSerializer{}, WithReadOnly())
+	assert.NoError(t, err)
+	defer readOnly.Close()
+	el, err := readOnly.Peek()
+	assert.NoError(t, err)
+	assert.Equal(t, MockData{1}, el)
+	assert.True(t, errors.Is(readOnly.Push(MockData{3}), ErrReadOnly))
+	_, err = readOnly.Poll()
+	assert.True(t, errors.Is(err, ErrReadOnly))
+	_, err = readOnly.Compact()
+	assert.True(t, errors.Is(err, ErrReadOnly))
+	assert.Equal(t, int64(2), queue.Size())
+}
+
+func TestOptions_CapacityDurabilityAndRecovery(t *testing.T) {
+	defer os.Remove("options-queue")
+	queue, err := OpenFileQueue("options-queue", &MockDataSerializer{},
+		WithCapacity(Capacity{MaxElements: 2}), WithDurability(DurabilitySync), WithReadAheadSize(0))
+	assert.NoError(t, err)
+	assert.Equal(t, DurabilitySync, queue.durability)
+	assert.Equal(t, int64(0), queue.readAheadSize)
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, queue.Push(MockData{int32(i)}))
+	}
+	assert.Same(t, ErrQueueFull, queue.Push(MockData{2}))
+	assert.NoError(t, os.Truncate("options-queue", queue.end()-2))
+	assert.NoError(t, queue.Close())
+
+	_, err = OpenFileQueue("options-queue", &MockDataSerializer{}, WithRecovery(RecoverStrict))
+	assert.Same(t, ErrTornTail, err)
+	logger := &recordingLogger{}
+	restored, err := OpenFileQueue("options-queue", &MockDataSerializer{}, WithLogger(logger))
+	assert.NoError(t, err)
+	defer restored.Close()
+	assert.Equal(t, int64(1), restored.Size())
+	assert.Len(t, logger.messages, 1)
+}
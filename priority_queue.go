@@ -0,0 +1,187 @@
+package eunomia
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Extension of the segment files of a PriorityFileQueue, every segment holds the elements of one priority.
+const prioritySegmentExtension = ".queue"
+
+// Computes the priority of an element, elements with a higher priority are polled first.
+type Prioritizer func(element interface{}) int
+
+// A persistent priority queue implementation of the Queue interface.
+// Every priority level is stored in it's own FileQueue segment inside the queue directory (i.e `<dir>/12.queue`),
+// Poll and Peek always look at the highest non empty priority, and elements sharing the same priority are kept in
+// FIFO order, even across restarts. It's safe to use a PriorityFileQueue from multiple goroutines.
+type PriorityFileQueue struct {
+	dirPath     string
+	serializer  Serializer
+	prioritizer Prioritizer
+	segments    map[int]*FileQueue
+	// priorities present in segments, sorted in descending order.
+	priorities []int
+	closed     bool
+	mu         sync.Mutex
+}
+
+// Creates or restores a priority queue stored in the given directory.
+// The prioritizer is used by Push to compute the priority of an element, if it's nil every element pushed via Push
+// will have the priority 0, use PushWithPriority to provide the priority explicitly.
+func NewPriorityFileQueue(dirPath string, serializer Serializer, prioritizer Prioritizer) (*PriorityFileQueue, error) {
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		return nil, err
+	}
+	queue := &PriorityFileQueue{
+		dirPath:     dirPath,
+		serializer:  serializer,
+		prioritizer: prioritizer,
+		segments:    make(map[int]*FileQueue),
+	}
+	entries, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, prioritySegmentExtension) {
+			continue
+		}
+		priority, err := strconv.Atoi(strings.TrimSuffix(name, prioritySegmentExtension))
+		if err != nil {
+			continue
+		}
+		if _, err := queue.segment(priority); err != nil {
+			// the segments opened so far are closed, the error of the failed one is more relevant.
+			_ = queue.Close()
+			return nil, err
+		}
+	}
+	return queue, nil
+}
+
+// Pushes the element with the priority computed by the queue's Prioritizer.
+func (p *PriorityFileQueue) Push(element interface{}) error {
+	priority := 0
+	if p.prioritizer != nil {
+		priority = p.prioritizer(element)
+	}
+	return p.PushWithPriority(element, priority)
+}
+
+// Pushes the element with the given priority, ignoring the queue's Prioritizer.
+func (p *PriorityFileQueue) PushWithPriority(element interface{}, priority int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrQueueClosed
+	}
+	segment, err := p.segment(priority)
+	if err != nil {
+		return err
+	}
+	return segment.Push(element)
+}
+
+func (p *PriorityFileQueue) Poll() (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrQueueClosed
+	}
+	segment := p.highest()
+	if segment == nil {
+		return nil, EmptyQueueError
+	}
+	return segment.Poll()
+}
+
+func (p *PriorityFileQueue) Peek() (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrQueueClosed
+	}
+	segment := p.highest()
+	if segment == nil {
+		return nil, EmptyQueueError
+	}
+	return segment.Peek()
+}
+
+func (p *PriorityFileQueue) Size() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	size := int64(0)
+	for _, segment := range p.segments {
+		size += segment.Size()
+	}
+	return size
+}
+
+// Closes the queue, and deletes every segment file, and the queue directory if it's left empty. The other files of
+// the directory are left untouched.
+func (p *PriorityFileQueue) Delete() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, priority := range p.priorities {
+		if err := p.segments[priority].Delete(); err != nil {
+			return err
+		}
+	}
+	p.segments = make(map[int]*FileQueue)
+	p.priorities = nil
+	entries, err := ioutil.ReadDir(p.dirPath)
+	if err != nil || len(entries) > 0 {
+		return err
+	}
+	return os.Remove(p.dirPath)
+}
+
+// Closes every segment, the queue cannot be used afterwards.
+func (p *PriorityFileQueue) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, priority := range p.priorities {
+		if err := p.segments[priority].Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the non empty segment with the highest priority, or nil if all the segments are empty.
+// The callers hold the lock of the queue, like for segment.
+func (p *PriorityFileQueue) highest() *FileQueue {
+	for _, priority := range p.priorities {
+		if segment := p.segments[priority]; segment.Size() > 0 {
+			return segment
+		}
+	}
+	return nil
+}
+
+// Returns the segment associated with the given priority, creating it if it does not exist yet.
+func (p *PriorityFileQueue) segment(priority int) (*FileQueue, error) {
+	if segment, ok := p.segments[priority]; ok {
+		return segment, nil
+	}
+	segmentPath := filepath.Join(p.dirPath, fmt.Sprintf("%d%s", priority, prioritySegmentExtension))
+	segment, err := OpenFileQueue(segmentPath, p.serializer)
+	if err != nil {
+		return nil, err
+	}
+	p.segments[priority] = segment
+	p.priorities = append(p.priorities, priority)
+	sort.Sort(sort.Reverse(sort.IntSlice(p.priorities)))
+	return segment, nil
+}
@@ -0,0 +1,147 @@
+package eunomia
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriorityFileQueue_PollHighestPriorityFirst(t *testing.T) {
+	queue, err := NewPriorityFileQueue("priority-queue", &MockDataSerializer{}, func(element interface{}) int {
+		return int(element.(MockData).value % 3)
+	})
+	assert.NoError(t, err)
+	defer queue.Delete()
+
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, queue.Push(MockData{int32(i)}))
+	}
+	assert.Equal(t, int64(6), queue.Size())
+
+	expected := []int32{2, 5, 1, 4, 0, 3}
+	for _, value := range expected {
+		el, err := queue.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, value, el.(MockData).value)
+	}
+	_, err = queue.Poll()
+	assert.Same(t, EmptyQueueError, err)
+}
+
+func TestPriorityFileQueue_PushWithPriority(t *testing.T) {
+	queue, err := NewPriorityFileQueue("priority-queue", &MockDataSerializer{}, nil)
+	assert.NoError(t, err)
+	defer queue.Delete()
+
+	assert.NoError(t, queue.Push(MockData{1}))
+	assert.NoError(t, queue.PushWithPriority(MockData{2}, -1))
+	assert.NoError(t, queue.PushWithPriority(MockData{3}, 10))
+
+	el, err := queue.Peek()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), el.(MockData).value)
+
+	for _, value := range []int32{3, 1, 2} {
+		el, err := queue.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, value, el.(MockData).value)
+	}
+}
+
+func TestPriorityFileQueue_RestoresSegments(t *testing.T) {
+	queue, err := NewPriorityFileQueue("priority-queue", &MockDataSerializer{}, nil)
+	assert.NoError(t, err)
+	defer queue.Delete()
+
+	assert.NoError(t, queue.PushWithPriority(MockData{1}, 1))
+	assert.NoError(t, queue.PushWithPriority(MockData{2}, 5))
+	assert.NoError(t, queue.PushWithPriority(MockData{3}, 5))
+
+	restored, err := NewPriorityFileQueue("priority-queue", &MockDataSerializer{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), restored.Size())
+
+	for _, value := range []int32{2, 3, 1} {
+		el, err := restored.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, value, el.(MockData).value)
+	}
+}
+
+func TestPriorityFileQueue_PushAfterDrain(t *testing.T) {
+	queue, err := NewPriorityFileQueue("priority-queue", &MockDataSerializer{}, nil)
+	assert.NoError(t, err)
+	defer queue.Delete()
+
+	assert.NoError(t, queue.Push(MockData{1}))
+	_, err = queue.Poll()
+	assert.NoError(t, err)
+
+	assert.NoError(t, queue.Push(MockData{2}))
+	assert.NoError(t, queue.Push(MockData{3}))
+
+	for _, value := range []int32{2, 3} {
+		el, err := queue.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, value, el.(MockData).value)
+	}
+}
+
+func TestPriorityFileQueue_Close(t *testing.T) {
+	queue, err := NewPriorityFileQueue("priority-queue", &MockDataSerializer{}, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, queue.PushWithPriority(MockData{1}, 1))
+	assert.NoError(t, queue.Close())
+	assert.Same(t, ErrQueueClosed, queue.PushWithPriority(MockData{2}, 2))
+	_, err = queue.Peek()
+	assert.Same(t, ErrQueueClosed, err)
+
+	restored, err := NewPriorityFileQueue("priority-queue", &MockDataSerializer{}, nil)
+	assert.NoError(t, err)
+	defer restored.Delete()
+	assert.Equal(t, int64(1), restored.Size())
+}
+
+func TestPriorityFileQueue_Concurrent(t *testing.T) {
+	queue, err := NewPriorityFileQueue("priority-queue", &MockDataSerializer{}, nil)
+	assert.NoError(t, err)
+	defer queue.Delete()
+
+	var wg sync.WaitGroup
+	for producer := 0; producer < 4; producer++ {
+		wg.Add(1)
+		go func(priority int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				assert.NoError(t, queue.PushWithPriority(MockData{int32(i)}, priority))
+			}
+		}(producer)
+	}
+	polled := 0
+	for polled < 200 {
+		if _, err := queue.Poll(); err == nil {
+			polled++
+		} else {
+			assert.Same(t, EmptyQueueError, err)
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, int64(0), queue.Size())
+}
+
+func TestPriorityFileQueue_DeleteKeepsOtherFiles(t *testing.T) {
+	defer os.RemoveAll("priority-queue")
+	queue, err := NewPriorityFileQueue("priority-queue", &MockDataSerializer{}, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, queue.PushWithPriority(MockData{1}, 1))
+	assert.NoError(t, ioutil.WriteFile("priority-queue/notes.txt", []byte("notes"), 0644))
+
+	assert.NoError(t, queue.Delete())
+	entries, err := ioutil.ReadDir("priority-queue")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "notes.txt", entries[0].Name())
+}
@@ -2,22 +2,58 @@ package eunomia
 
 import (
 	"bytes"
+	"compress/flate"
+	"context"
 	"errors"
 	"io"
+	"io/ioutil"
 	"os"
+	"sync"
+	"time"
 )
 
-var buffer = make([]byte, 64)
-
 var (
 	NewFileError                        = errors.New("file has never been initialized")
 	CorruptVersionError                 = errors.New("invalid version in the file header")
 	UnexpectedNumberOfWrittenBytesError = errors.New("the number of written bytes and the number of expected bytes to be written is different")
 	EmptyQueueError                     = errors.New("cannot peek or poll from an empty queue")
+	ErrIncompatibleFlags                = errors.New("the flags in the file header are not supported by this queue type")
+	ErrIndexOutOfBounds                 = errors.New("the index is out of the bounds of the queue")
+	ErrQueueClosed                      = errors.New("the queue is closed")
 )
 
 // Magic number to act as the version, for backward compatibility guarantees.
-const MagicVersionNumber int32 = 0x23
+const MagicVersionNumber int32 = 0x24
+
+// Version of the files written before the header had timestamps, they are upgraded when opened.
+const legacyVersionNumber int32 = 0x23
+
+// Size in bytes of the file header, the first element is written right after it.
+const headerSize int64 = 48
+
+// Size in bytes of the header of the legacy files.
+const legacyHeaderSize int64 = 32
+
+// Size in bytes of the capacity limits written after the header of bounded queues.
+const capacitySize int64 = 16
+
+// Bits of the flags field of the header.
+const (
+	// Every element is followed by a second copy of it's length, allowing to walk the file from the tail to the head.
+	FlagTrailingLength int32 = 1 << iota
+	// The file is a FileLog, every element starts with the timestamp at which it was appended.
+	FlagLog
+	// The queue has a capacity, the limits are written right after the header.
+	FlagBounded
+	// The data of every element starts with it's CRC32 checksum.
+	FlagChecksum
+	// The data of every element is compressed with flate.
+	FlagCompressed
+)
+
+// The flags this version understands, a file with any other flag cannot be read since the flags change how the
+// elements are stored.
+const knownFlags = FlagTrailingLength | FlagLog | FlagBounded | FlagChecksum | FlagCompressed
 
 type Queue interface {
 	Push(element interface{}) error
@@ -29,11 +65,28 @@ type Queue interface {
 	Size() int64
 
 	Delete() error
+
+	Close() error
+}
+
+// A Queue whose elements can be read and modified in place without being consumed.
+type IndexedQueue interface {
+	Queue
+
+	// Returns the element at the given position, the head being at position 0.
+	Get(i int64) (interface{}, error)
+
+	// Returns a sequence over the elements, from the head to the tail.
+	All() func(yield func(interface{}, error) bool)
+
+	RemoveIf(predicate func(interface{}) bool) (int, error)
+
+	ReplaceIf(predicate func(interface{}) bool, replacement func(interface{}) interface{}) (int, error)
 }
 
 // Types that we can push onto the queue should adhere to the following contract:
 //   Write: An element should be responsible of writing itself as a sequence of bytes.
-//    (Note: This implies a temporary buffer is allocated this should be taken care of in the next iteration)
+//    (Note: This implies a temporary buffer is allocated, implement AppendSerializer to avoid it)
 //
 //   Read: An element should be able to restore it's state from a given io.Reader
 type Serializer interface {
@@ -42,138 +95,558 @@ type Serializer interface {
 	Read(reader io.Reader) interface{}
 }
 
+// A Serializer able to write elements at the end of a given buffer, the queues use it instead of Write to serialize
+// the elements in reused buffers without allocating.
+type AppendSerializer interface {
+	Serializer
+
+	// Appends the serialized element to dst, and returns the extended buffer.
+	AppendTo(dst []byte, element interface{}) []byte
+}
+
+// Buffers used to frame the pushed elements, so that pushing does not allocate.
+var frameBuffers = sync.Pool{
+	New: func() interface{} {
+		buffer := make([]byte, 0, 256)
+		return &buffer
+	},
+}
+
+// Returns the element framed as [length, data], serialized at the start of the given buffer.
+func frameElement(dst []byte, serializer Serializer, element interface{}) []byte {
+	dst = append(dst[:0], 0, 0, 0, 0, 0, 0, 0, 0)
+	if appender, ok := serializer.(AppendSerializer); ok {
+		dst = appender.AppendTo(dst, element)
+	} else {
+		dst = append(dst, serializer.Write(element)...)
+	}
+	putLong(dst, int64(len(dst)-8))
+	return dst
+}
+
+// How hard the queue tries to make it's operations durable.
+type Durability int
+
+const (
+	// The writes are left to the storage, the last operations can be lost if the machine crashes.
+	DurabilityNone Durability = iota
+	// The storage is synced (fsync, msync...) after every operation modifying the queue.
+	DurabilitySync
+)
+
 // A Flat file-based implementation of the Queue interface.
 // TODO(chermehdi): add docs and examples.
 type FileQueue struct {
 	filePath   string
 	writer     *QueueProtocolWriter
 	serializer Serializer
+	// guards the header and the backing file, so that the queue can be shared between goroutines.
+	mu sync.Mutex
+	// last element accessed by Get.
+	cursor *elementPtr
+	// what to do when pushing to a full bounded queue.
+	overflow OverflowPolicy
+	// closed and reset when space is freed in the queue, to wake up the blocked pushes.
+	space chan struct{}
+	// called without the lock when a push starts waiting for space, nil outside of the tests.
+	blocked    func()
+	durability Durability
+	// block of the file read ahead of the last accessed element.
+	ahead         readAhead
+	readAheadSize int64
+	// reused to deserialize the elements.
+	reader bytes.Reader
+	// incremented every time the live elements are moved or overwritten, so that the copies made without holding the
+	// lock (see Snapshot) can detect it.
+	moves int64
+	// the FlagChecksum and FlagCompressed flags of the file, they never change once the queue is opened.
+	codec            int32
+	compressionLevel int
 }
 
-// Creates or restores a new flat-file queue from the given file path.
+// Creates or restores a new flat-file queue from the given file path, configured by the given options.
 // If the file is corrupt (i.e it already exists and it has an unexpected format) this will return a corruption error.
-func NewFileQueue(filePath string, serializer Serializer) (Queue, error) {
-	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR, 0755) // maybe parametrize the default permissions
+// If the last elements were not fully written before a crash, they are dropped and logged, see WithRecovery.
+func NewFileQueue(filePath string, serializer Serializer, opts ...Option) (Queue, error) {
+	queue, err := OpenFileQueue(filePath, serializer, opts...)
 	if err != nil {
 		return nil, err
 	}
-	protoWriter, err := NewQueueWriter(file)
+	return queue, nil
+}
+
+// Same as NewFileQueue but returns the concrete type.
+func OpenFileQueue(filePath string, serializer Serializer, opts ...Option) (*FileQueue, error) {
+	o := newOptions(opts)
+	storage, err := o.openStorage(filePath)
 	if err != nil {
 		return nil, err
 	}
-	return &FileQueue{
-		filePath:   filePath,
-		writer:     protoWriter,
-		serializer: serializer,
-	}, nil
+	queue, err := newStorageQueue(storage, serializer, o)
+	if err != nil {
+		storage.Close()
+		return nil, err
+	}
+	queue.filePath = filePath
+	return queue, nil
+}
+
+// Creates or restores a queue written to the given storage, instead of a file.
+// If the storage is empty, a new queue is initialized in it. The options opening the file (WithFileMode,
+// WithMustExist) are ignored.
+func NewStorageQueue(storage Storage, serializer Serializer, opts ...Option) (*FileQueue, error) {
+	return newStorageQueue(storage, serializer, newOptions(opts))
+}
+
+func newStorageQueue(storage Storage, serializer Serializer, o *options) (*FileQueue, error) {
+	if o.compression {
+		if _, err := flate.NewWriter(ioutil.Discard, o.compressionLevel); err != nil {
+			return nil, err
+		}
+	}
+	if o.readOnly {
+		if !fileExist(storage) {
+			return nil, NewFileError
+		}
+		// the older versions are upgraded in place.
+		version, err := ReadInt(storage, 0)
+		if err != nil {
+			return nil, err
+		}
+		if version < MagicVersionNumber {
+			return nil, ErrUnsupportedVersion
+		}
+	}
+	protoWriter, err := newQueueWriterWithFlags(storage, o.flags())
+	if err != nil {
+		return nil, err
+	}
+	flags := protoWriter.header.flags
+	if flags&(FlagTrailingLength|FlagLog) != 0 {
+		return nil, ErrIncompatibleFlags
+	}
+	// the flags are set when the file is created, they cannot be added to an existing file.
+	if requested := o.flags(); flags&requested != requested {
+		return nil, ErrIncompatibleFlags
+	}
+	if o.readOnly {
+		// a torn tail cannot be repaired without writing to the file.
+		protoWriter.openedReadOnly = true
+		torn, err := protoWriter.tornTail()
+		if err != nil {
+			return nil, err
+		}
+		if torn {
+			return nil, ErrTornTail
+		}
+	} else if err := protoWriter.recover(o.recovery); err != nil {
+		return nil, err
+	}
+	queue := &FileQueue{
+		writer:           protoWriter,
+		serializer:       serializer,
+		durability:       o.durability,
+		readAheadSize:    o.readAheadSize,
+		codec:            flags & codecFlags,
+		compressionLevel: o.compressionLevel,
+	}
+	if o.capacity != nil {
+		if err := protoWriter.writable(); err != nil {
+			return nil, err
+		}
+		header := protoWriter.header
+		header.maxElements = o.capacity.MaxElements
+		header.maxBytes = o.capacity.MaxBytes
+		if err := writeHeader(storage, header); err != nil {
+			return nil, err
+		}
+		queue.overflow = o.capacity.Policy
+	}
+	return queue, nil
 }
 
 // There two cases when pushing to the queue
 // 1- The queue is empty, this is the first element the head and tail are pointing to the same offset
 //    And this will stay the after the call to push, we only are going to update the lengths
 // 2- The queue already contains some 1 or more elements.
+//
+// If the queue is bounded and full, the behaviour depends on the queue's OverflowPolicy, a blocking queue waits
+// until some space is available, use PushContext to bound the wait.
 func (f *FileQueue) Push(element interface{}) error {
-	data := f.serializer.Write(element)
-	header := f.writer.header
-	dataLength := int64(len(data))
-	if f.Size() == 0 {
-		header.tail.length = dataLength
-		header.head.length = dataLength
-	} else {
-		header.tail.offset = header.tail.offset + header.tail.length + 8
-		header.tail.length = dataLength
+	return f.PushContext(context.Background(), element)
+}
+
+// Same as Push, but gives up waiting for space in a full blocking queue once the context is done.
+func (f *FileQueue) PushContext(ctx context.Context, element interface{}) error {
+	if f.codec != 0 {
+		return f.pushData(ctx, f.serializer.Write(element))
+	}
+	pooled := frameBuffers.Get().(*[]byte)
+	defer frameBuffers.Put(pooled)
+	frame := frameElement(*pooled, f.serializer, element)
+	*pooled = frame[:0]
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.appendFrame(ctx, frame); err != nil && err != errDropped {
+		return err
+	}
+	return f.sync()
+}
+
+// Pushes an already serialized element.
+func (f *FileQueue) pushData(ctx context.Context, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.appendData(ctx, data); err != nil && err != errDropped {
+		return err
+	}
+	return f.sync()
+}
+
+// Pushes the serialized elements in order until one of them cannot be pushed, and returns the number of pushed
+// elements, so that they are always the first ones. An element dropped by a full OverflowDropNewest queue fails with
+// ErrQueueFull. The elements of an unbounded queue are pushed with a single write, see pushBatch.
+func (f *FileQueue) pushPrefix(ctx context.Context, elements [][]byte) (int64, error) {
+	f.mu.Lock()
+	if f.writer.header.flags&FlagBounded == 0 {
+		f.mu.Unlock()
+		if err := f.pushBatch(ctx, elements)[0]; err != nil {
+			return 0, err
+		}
+		return int64(len(elements)), nil
 	}
-	if _, err := WriteLong(f.writer.backingFile, header.tail.offset, dataLength); err != nil {
+	defer f.mu.Unlock()
+	for i, data := range elements {
+		err := f.appendData(ctx, data)
+		if err == errDropped {
+			err = ErrQueueFull
+		}
+		if err != nil {
+			if syncErr := f.sync(); syncErr != nil {
+				return 0, syncErr
+			}
+			return int64(i), err
+		}
+	}
+	if err := f.sync(); err != nil {
+		return 0, err
+	}
+	return int64(len(elements)), nil
+}
+
+// Writes the serialized element after the tail and updates the header, without syncing.
+func (f *FileQueue) appendData(ctx context.Context, data []byte) error {
+	pooled := frameBuffers.Get().(*[]byte)
+	defer frameBuffers.Put(pooled)
+	frame := append((*pooled)[:0], 0, 0, 0, 0, 0, 0, 0, 0)
+	frame = f.encode(frame, data)
+	putLong(frame, int64(len(frame)-8))
+	*pooled = frame[:0]
+	return f.appendFrame(ctx, frame)
+}
+
+// Same as appendData, for an element already framed as [length, data].
+// The frame is written with a single write, and the tail pointer is updated in place, since nothing else points to it.
+func (f *FileQueue) appendFrame(ctx context.Context, frame []byte) error {
+	if err := f.writable(); err != nil {
 		return err
 	}
-	if _, err := WriteChunk(f.writer.backingFile, header.tail.offset+8, data); err != nil {
+	dataLength := int64(len(frame) - 8)
+	accepted, err := f.makeRoom(ctx, dataLength)
+	if err != nil {
 		return err
 	}
-	header.elementCount++
-	if err := writeHeader(f.writer.backingFile, header); err != nil {
+	if !accepted {
+		return errDropped
+	}
+	header := f.writer.header
+	offset := header.head.offset
+	index := header.head.index
+	if header.elementCount != 0 {
+		offset = header.tail.offset + header.tail.length + 8
+		index = header.tail.index + 1
+	} else {
+		// the head of an empty queue is the last polled element, which is overwritten.
+		f.moves++
+	}
+	f.ahead.written(offset, int64(len(frame)))
+	if _, err := WriteChunk(f.writer.backingFile, offset, frame); err != nil {
 		return err
 	}
-	return nil
+	if header.elementCount == 0 {
+		header.head.length = dataLength
+	}
+	header.tail.offset = offset
+	header.tail.length = dataLength
+	header.tail.index = index
+	header.elementCount++
+	return writeHeader(f.writer.backingFile, header)
 }
 
 func (f *FileQueue) Poll() (interface{}, error) {
-	if f.Size() == 0 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.writer.checkOpen(); err != nil {
+		return nil, err
+	}
+	if f.writer.header.elementCount == 0 {
 		return nil, EmptyQueueError
 	}
-	head := f.writer.header.head
-	data, err := ReadChunk(f.writer.backingFile, head.offset+8, head.length)
+	element, err := f.readElement(f.writer.header.head)
 	if err != nil {
 		return nil, err
 	}
-	element := f.serializer.Read(bytes.NewReader(data))
-	var newHead *elementPtr
-	if f.Size() == 1 {
-		newHead = f.writer.header.tail
+	if err := f.removeHead(); err != nil {
+		return nil, err
+	}
+	if err := f.sync(); err != nil {
+		return nil, err
+	}
+	return element, nil
+}
+
+// Sets the durability policy of the queue, the default being DurabilityNone.
+func (f *FileQueue) SetDurability(durability Durability) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.durability = durability
+}
+
+// Syncs the storage if the durability policy requires it.
+func (f *FileQueue) sync() error {
+	if f.durability == DurabilitySync {
+		return f.writer.backingFile.Sync()
+	}
+	return nil
+}
+
+// Moves the head of the queue to the next element, and persists the updated header.
+// The head pointer is only updated once the header is written, in place to avoid allocating.
+func (f *FileQueue) removeHead() error {
+	if err := f.writable(); err != nil {
+		return err
+	}
+	head := f.writer.header.head
+	var newHead elementPtr
+	if f.writer.header.elementCount == 1 {
+		// copy the tail pointer, so that the next pushes moving the tail don't drag the head along.
+		newHead = elementPtr{
+			offset: f.writer.header.tail.offset,
+			length: f.writer.header.tail.length,
+			index:  head.index + 1,
+		}
 	} else {
-		nextElLength, err := ReadLong(f.writer.backingFile, head.offset+8+head.length)
+		var err error
+		newHead, err = f.next(head)
 		if err != nil {
-			return nil, err
-		}
-		newHead = &elementPtr{
-			offset: head.offset + 8 + head.length,
-			length: nextElLength,
+			return err
 		}
 	}
-	updatedHeader := &header{
-		head:         newHead,
-		tail:         f.writer.header.tail,
-		elementCount: f.writer.header.elementCount - 1,
-		version:      f.writer.header.version,
-		flags:        f.writer.header.flags,
-	}
-	if err = writeHeader(f.writer.backingFile, updatedHeader); err != nil {
-		return nil, err
+	updatedHeader := *f.writer.header
+	updatedHeader.head = &newHead
+	updatedHeader.elementCount--
+	if err := writeHeader(f.writer.backingFile, &updatedHeader); err != nil {
+		return err
 	}
-	f.writer.header = updatedHeader
-	return element, nil
+	*head = newHead
+	f.writer.header.elementCount--
+	f.writer.header.updatedAt = updatedHeader.updatedAt
+	f.signalSpace()
+	return nil
 }
 
 func (f *FileQueue) Peek() (interface{}, error) {
-	if f.Size() == 0 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.writer.checkOpen(); err != nil {
+		return nil, err
+	}
+	if f.writer.header.elementCount == 0 {
 		return nil, EmptyQueueError
 	}
-	head := f.writer.header.head
-	data, err := ReadChunk(f.writer.backingFile, head.offset+8, head.length)
+	return f.readElement(f.writer.header.head)
+}
+
+func (f *FileQueue) Size() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.writer.header.elementCount
+}
+
+// Returns the offset right after the last element of the queue, i.e the number of bytes used in the file.
+func (f *FileQueue) end() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.liveEnd()
+}
+
+// Same as end, for the callers already holding the lock.
+func (f *FileQueue) liveEnd() int64 {
+	header := f.writer.header
+	if header.elementCount == 0 {
+		return header.tail.offset
+	}
+	return header.tail.offset + 8 + header.tail.length
+}
+
+// Returns the element at the given position, the head of the queue being at position 0, without removing it.
+// The file is walked starting from the head, or from the last element accessed by Get if it comes before the
+// requested one, so iterating over increasing indexes does not walk the file from the start every time.
+func (f *FileQueue) Get(i int64) (interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.writer.checkOpen(); err != nil {
+		return nil, err
+	}
+	header := f.writer.header
+	if i < 0 || i >= header.elementCount {
+		return nil, ErrIndexOutOfBounds
+	}
+	target := header.head.index + i
+	ptr := header.head
+	if f.cursor != nil && f.cursor.index >= header.head.index && f.cursor.index <= target {
+		ptr = f.cursor
+	}
+	for ptr.index < target {
+		next, err := f.next(ptr)
+		if err != nil {
+			return nil, err
+		}
+		ptr = &next
+	}
+	f.cursor = ptr
+	return f.readElement(ptr)
+}
+
+// Reads and deserializes the element pointed to by the given pointer.
+func (f *FileQueue) readElement(ptr *elementPtr) (interface{}, error) {
+	stored, err := f.read(ptr.offset+8, ptr.length)
 	if err != nil {
 		return nil, err
 	}
-	return f.serializer.Read(bytes.NewReader(data)), nil
+	data, err := f.decode(stored)
+	if err != nil {
+		return nil, err
+	}
+	f.reader.Reset(data)
+	return f.serializer.Read(&f.reader), nil
 }
 
-func (f *FileQueue) Size() int64 {
-	return f.writer.header.elementCount
+// Returns a pointer to the element written right after the given one.
+func (f *FileQueue) next(ptr *elementPtr) (elementPtr, error) {
+	offset := ptr.offset + 8 + ptr.length
+	data, err := f.read(offset, 8)
+	if err != nil {
+		return elementPtr{}, err
+	}
+	return elementPtr{
+		offset: offset,
+		length: getLong(data),
+		index:  ptr.index + 1,
+	}, nil
 }
 
+// Closes the queue and deletes it's file, a queue created on a Storage has no file, it's storage is truncated before
+// being closed instead. A queue opened read-only cannot be deleted.
 func (f *FileQueue) Delete() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.writer.openedReadOnly {
+		return f.writable()
+	}
+	f.ahead.invalidate()
+	f.moves++
+	f.signalSpace()
+	if f.filePath == "" {
+		if err := f.writer.checkOpen(); err != nil {
+			return err
+		}
+		if err := f.writer.backingFile.Truncate(0); err != nil {
+			return err
+		}
+		return f.writer.close()
+	}
+	if err := f.writer.close(); err != nil {
+		return err
+	}
 	return os.Remove(f.filePath)
 }
 
+// Returns ErrQueueClosed once the queue is closed.
+func (f *FileQueue) checkOpen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.writer.checkOpen()
+}
+
+// Syncs and closes the file of the queue, the pushes waiting for space in a full queue are woken up, and every
+// operation on the queue fails with ErrQueueClosed afterwards. Closing a closed queue does nothing.
+func (f *FileQueue) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ahead.invalidate()
+	// the copies made without holding the lock start over, and see that the queue is closed.
+	f.moves++
+	f.signalSpace()
+	return f.writer.close()
+}
+
 // an element dictating how to write elements
 // Protocol description:
 //
 // version                        4 byte
+// flags                          4 byte
 // created_at timestamp           8 bytes
 // last_updated_at timestamp      8 bytes
 // elementCount                   8 bytes
+// headOffset                     8 bytes
+// tailOffset                     8 bytes
 // firstElementLength             8 bytes
 // firstElement                   firstElementLength bytes
 // ..
 // lastElementLength    8 bytes
 // lastElement          lastElementLength bytes
 type QueueProtocolWriter struct {
-	backingFile *os.File
+	backingFile Storage
 	header      *header
+	// number of bytes the elements were moved by when upgrading a legacy file, the offsets kept outside of the file
+	// need to be moved as well.
+	upgradeShift int64
+	// set for the files written by a newer minor version, they can be read but not modified.
+	readOnly bool
+	// set once the backing storage is closed.
+	closed bool
+	// set when the file was opened with the WithReadOnly option.
+	openedReadOnly bool
+}
+
+// Syncs and closes the backing storage, the writer cannot be used afterwards.
+func (w *QueueProtocolWriter) close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if err := w.backingFile.Sync(); err != nil {
+		w.backingFile.Close()
+		return err
+	}
+	return w.backingFile.Close()
+}
+
+// Returns ErrQueueClosed once the writer is closed.
+func (w *QueueProtocolWriter) checkOpen() error {
+	if w.closed {
+		return ErrQueueClosed
+	}
+	return nil
 }
 
 // Pointer to some data element in the file
 // Each element is identified by it's start position and it's length (in bytes).
 // The elements are written [elementLength,elementData] and the offset points to the first
 // byte of the elementLength, i.e when reading any element, the data starts at offset + 8 and not at offset
+// The index is the position of the element since the queue was opened, it's not persisted and only used to know
+// whether an element has already been polled.
 type elementPtr struct {
 	offset int64
 	length int64
@@ -187,41 +660,63 @@ type header struct {
 	flags        int32
 	head         *elementPtr
 	tail         *elementPtr
+	// unix timestamps in nanoseconds, a created_at of 0 means unknown, for the upgraded legacy files.
+	createdAt int64
+	updatedAt int64
+	// capacity limits, only persisted if the FlagBounded flag is set, 0 means no limit.
+	maxElements int64
+	maxBytes    int64
 }
 
-func NewQueueWriter(backingFile *os.File) (*QueueProtocolWriter, error) {
+// Returns the offset right after the tail element.
+func (h *header) end() int64 {
+	if h.elementCount == 0 {
+		return h.tail.offset
+	}
+	frameSize := int64(8)
+	if h.flags&FlagTrailingLength != 0 {
+		frameSize = 16
+	}
+	return h.tail.offset + frameSize + h.tail.length
+}
+
+func NewQueueWriter(backingFile Storage) (*QueueProtocolWriter, error) {
+	return newQueueWriterWithFlags(backingFile, 0)
+}
+
+// Creates a writer on the given file, if the file is new, it's header is initialized with the given flags.
+func newQueueWriterWithFlags(backingFile Storage, flags int32) (*QueueProtocolWriter, error) {
 	writer := &QueueProtocolWriter{
 		backingFile: backingFile,
 	}
 	if !fileExist(backingFile) {
-		header, err := fillEmptyQueueFile(backingFile)
+		header, err := fillEmptyQueueFile(backingFile, flags)
 		if err != nil {
 			return nil, err
 		}
 		writer.header = header
 		return writer, nil
 	}
-	header, err := checkCorrupt(backingFile)
-	if err != nil {
+	if err := writer.open(); err != nil {
 		return nil, err
 	}
-	writer.header = header
 	return writer, nil
 }
 
 // Fills the passed empty header by the default header parameters and returns the created header.
 // Any sort of error during the process is returned.
-func fillEmptyQueueFile(file *os.File) (*header, error) {
+func fillEmptyQueueFile(file Storage, flags int32) (*header, error) {
 	header := &header{
 		version:      MagicVersionNumber,
-		flags:        int32(0),
+		flags:        flags,
+		createdAt:    time.Now().UnixNano(),
 		elementCount: int64(0),
 		head: &elementPtr{
-			offset: int64(32),
+			offset: dataStart(flags),
 			length: 0,
 		},
 		tail: &elementPtr{
-			offset: int64(32),
+			offset: dataStart(flags),
 			length: 0,
 		},
 	}
@@ -235,18 +730,14 @@ func fillEmptyQueueFile(file *os.File) (*header, error) {
 // Check if the given file is corrupt, i.e does not correspond to the protocol contract
 // If the file is valid, return pointers to both head element and tail element.
 // Head and Tail pointers can be the same.
-func checkCorrupt(file *os.File) (*header, error) {
-	length, err := fileLength(file)
+func checkCorrupt(file Storage) (*header, error) {
+	length, err := file.Size()
 	if err != nil {
 		return nil, err
 	}
 	if length == 0 {
 		return nil, err
 	}
-	_, err = file.Seek(0, io.SeekStart)
-	if err != nil {
-		return nil, err
-	}
 	header := &header{}
 	currentOffset := int64(0)
 	version, err := ReadInt(file, currentOffset)
@@ -254,18 +745,28 @@ func checkCorrupt(file *os.File) (*header, error) {
 	if err != nil {
 		return nil, err
 	}
-	if version != MagicVersionNumber {
+	if !readableVersion(version) {
 		return nil, CorruptVersionError
 	}
 	header.version = version
-	// TODO(chermehdi): Use the flags
 	flags, err := ReadInt(file, currentOffset)
 	currentOffset += 4
 	if err != nil {
 		return nil, err
 	}
+	if flags&^knownFlags != 0 {
+		return nil, ErrIncompatibleFlags
+	}
 	header.flags = flags
 
+	if header.createdAt, err = ReadLong(file, currentOffset); err != nil {
+		return nil, err
+	}
+	if header.updatedAt, err = ReadLong(file, currentOffset+8); err != nil {
+		return nil, err
+	}
+	currentOffset += 16
+
 	elementCount, err := ReadLong(file, currentOffset)
 	currentOffset += 8
 	if err != nil {
@@ -283,6 +784,14 @@ func checkCorrupt(file *os.File) (*header, error) {
 	if err != nil {
 		return nil, err
 	}
+	if flags&FlagBounded != 0 {
+		if header.maxElements, err = ReadLong(file, currentOffset); err != nil {
+			return nil, err
+		}
+		if header.maxBytes, err = ReadLong(file, currentOffset+8); err != nil {
+			return nil, err
+		}
+	}
 	header.head = &elementPtr{
 		offset: headOffset,
 		length: 0,
@@ -291,6 +800,9 @@ func checkCorrupt(file *os.File) (*header, error) {
 		offset: tailOffset,
 		length: 0,
 	}
+	if elementCount > 0 {
+		header.tail.index = elementCount - 1
+	}
 	headLength, err := ReadLong(file, headOffset)
 	if err == nil {
 		header.head.length = headLength
@@ -302,10 +814,37 @@ func checkCorrupt(file *os.File) (*header, error) {
 	return header, nil
 }
 
-func fileLength(file *os.File) (int64, error) {
-	info, err := file.Stat()
+// Returns the offset of the first element in a new file with the given flags.
+func dataStart(flags int32) int64 {
+	if flags&FlagBounded != 0 {
+		return headerSize + capacitySize
+	}
+	return headerSize
+}
+
+// Reads the header of a queue file of any type, written with any version the library can read, without upgrading it.
+func readAnyHeader(file Storage) (*header, error) {
+	version, err := ReadInt(file, 0)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case readableVersion(version):
+		return checkCorrupt(file)
+	case version == legacyVersionNumber:
+		return readLegacyHeader(file)
+	default:
+		return nil, ErrUnsupportedVersion
+	}
+}
+
+// Returns the offset right after the tail element of the queue file, according to it's header. The bytes after it
+// are not part of any element.
+func dataEnd(file Storage) (int64, error) {
+	header, err := readAnyHeader(file)
 	if err != nil {
-		return -1, err
+		return 0, err
 	}
-	return info.Size(), nil
+	return header.end(), nil
 }
+
@@ -139,6 +139,115 @@ func BenchmarkFileQueue_Push_Complex(b *testing.B) {
 	}
 }
 
+// Opens the storage used by the storage benchmarks.
+type storageOpener func(filePath string) (Storage, error)
+
+func openFileStorage(filePath string) (Storage, error) {
+	return OpenFileStorage(filePath)
+}
+
+func openMmapStorage(filePath string) (Storage, error) {
+	return OpenMmapStorage(filePath)
+}
+
+func StorageQueueSetup(storage Storage, durability Durability) (*FileQueue, error) {
+	queue, err := NewStorageQueue(storage, &MockDataSerializer{})
+	if err != nil {
+		return nil, err
+	}
+	queue.SetDurability(durability)
+	return queue, nil
+}
+
+// Opens a queue on the storage returned by open, the benchmark is skipped if the storage is not supported.
+func benchmarkStorageQueue(b *testing.B, open storageOpener, durability Durability) (*FileQueue, func()) {
+	storage, err := open("bench-queue")
+	if err != nil {
+		b.Skip(err)
+	}
+	queue, err := StorageQueueSetup(storage, durability)
+	if err != nil {
+		panic(err)
+	}
+	return queue, func() {
+		storage.Close()
+		os.Remove("bench-queue")
+	}
+}
+
+func benchmarkStoragePush(b *testing.B, open storageOpener, durability Durability) {
+	queue, cleanup := benchmarkStorageQueue(b, open, durability)
+	defer cleanup()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := queue.Push(MockData{int32(i)}); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func benchmarkStoragePoll(b *testing.B, open storageOpener, durability Durability) {
+	queue, cleanup := benchmarkStorageQueue(b, open, durability)
+	defer cleanup()
+	for i := 0; i < b.N; i++ {
+		if err := queue.Push(MockData{int32(i)}); err != nil {
+			panic(err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		optimisationPreventer, _ = queue.Poll()
+	}
+}
+
+func BenchmarkFileStorage_Push(b *testing.B) {
+	benchmarkStoragePush(b, openFileStorage, DurabilityNone)
+}
+
+func BenchmarkMmapStorage_Push(b *testing.B) {
+	benchmarkStoragePush(b, openMmapStorage, DurabilityNone)
+}
+
+func BenchmarkFileStorage_Push_Sync(b *testing.B) {
+	benchmarkStoragePush(b, openFileStorage, DurabilitySync)
+}
+
+func BenchmarkMmapStorage_Push_Sync(b *testing.B) {
+	benchmarkStoragePush(b, openMmapStorage, DurabilitySync)
+}
+
+func BenchmarkFileStorage_Poll(b *testing.B) {
+	benchmarkStoragePoll(b, openFileStorage, DurabilityNone)
+}
+
+func BenchmarkMmapStorage_Poll(b *testing.B) {
+	benchmarkStoragePoll(b, openMmapStorage, DurabilityNone)
+}
+
+func BenchmarkFileQueue_PushPoll_Append(b *testing.B) {
+	storage, err := OpenFileStorage("bench-queue")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove("bench-queue")
+	defer storage.Close()
+	queue, err := NewStorageQueue(storage, &AppendIntSerializer{})
+	if err != nil {
+		panic(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := queue.Push(i % 200); err != nil {
+			panic(err)
+		}
+		optimisationPreventer, _ = queue.Poll()
+	}
+}
+
 type Address struct {
 	StreetName string
 	PostalCode string
@@ -207,3 +316,19 @@ func (c ComplexSerializer) Read(reader io.Reader) interface{} {
 	}
 	return result
 }
+
+func BenchmarkFileStorage_BatchPush_Sync(b *testing.B) {
+	queue, cleanup := benchmarkStorageQueue(b, openFileStorage, DurabilitySync)
+	defer cleanup()
+	writer := NewBatchWriter(queue, 1024, 0)
+	defer writer.Close()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := writer.Push(MockData{1}).Wait(); err != nil {
+				panic(err)
+			}
+		}
+	})
+}
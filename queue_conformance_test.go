@@ -0,0 +1,138 @@
+package eunomia
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// Behaviour every IndexedQueue implementation must have, so that they can be swapped for one another.
+var conformanceCases = []struct {
+	name string
+	test func(t *testing.T, queue IndexedQueue)
+}{
+	{"EmptyQueue", func(t *testing.T, queue IndexedQueue) {
+		assert.Equal(t, int64(0), queue.Size())
+		_, err := queue.Peek()
+		assert.Same(t, EmptyQueueError, err)
+		_, err = queue.Poll()
+		assert.Same(t, EmptyQueueError, err)
+		_, err = queue.Get(0)
+		assert.Same(t, ErrIndexOutOfBounds, err)
+	}},
+	{"FIFO", func(t *testing.T, queue IndexedQueue) {
+		for i := 0; i < 20; i++ {
+			assert.NoError(t, queue.Push(MockData{int32(i)}))
+		}
+		assert.Equal(t, int64(20), queue.Size())
+		for i := 0; i < 20; i++ {
+			el, err := queue.Peek()
+			assert.NoError(t, err)
+			assert.Equal(t, MockData{int32(i)}, el)
+			el, err = queue.Poll()
+			assert.NoError(t, err)
+			assert.Equal(t, MockData{int32(i)}, el)
+		}
+		assert.Equal(t, int64(0), queue.Size())
+	}},
+	{"ElementsAreCopies", func(t *testing.T, queue IndexedQueue) {
+		assert.NoError(t, queue.Push(&MockData{1}))
+		el, err := queue.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, MockData{1}, el)
+	}},
+	{"PushAfterDrain", func(t *testing.T, queue IndexedQueue) {
+		assert.NoError(t, queue.Push(MockData{1}))
+		_, err := queue.Poll()
+		assert.NoError(t, err)
+		assert.NoError(t, queue.Push(MockData{2}))
+		assert.NoError(t, queue.Push(MockData{3}))
+		for _, value := range []int32{2, 3} {
+			el, err := queue.Poll()
+			assert.NoError(t, err)
+			assert.Equal(t, MockData{value}, el)
+		}
+	}},
+	{"GetAndAll", func(t *testing.T, queue IndexedQueue) {
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, queue.Push(MockData{int32(i)}))
+		}
+		_, err := queue.Poll()
+		assert.NoError(t, err)
+
+		el, err := queue.Get(3)
+		assert.NoError(t, err)
+		assert.Equal(t, MockData{4}, el)
+		_, err = queue.Get(4)
+		assert.Same(t, ErrIndexOutOfBounds, err)
+
+		visited := make([]interface{}, 0)
+		queue.All()(func(element interface{}, err error) bool {
+			assert.NoError(t, err)
+			visited = append(visited, element)
+			return len(visited) < 3
+		})
+		assert.Equal(t, []interface{}{MockData{1}, MockData{2}, MockData{3}}, visited)
+		assert.Equal(t, int64(4), queue.Size())
+	}},
+	{"RemoveAndReplace", func(t *testing.T, queue IndexedQueue) {
+		for i := 0; i < 6; i++ {
+			assert.NoError(t, queue.Push(MockData{int32(i)}))
+		}
+		removed, err := queue.RemoveIf(func(element interface{}) bool {
+			return element.(MockData).value < 2
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, removed)
+		replaced, err := queue.ReplaceIf(func(element interface{}) bool {
+			return element.(MockData).value%2 == 0
+		}, func(element interface{}) interface{} {
+			return MockData{-element.(MockData).value}
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, replaced)
+
+		assert.Equal(t, int64(4), queue.Size())
+		for _, value := range []int32{-2, 3, -4, 5} {
+			el, err := queue.Poll()
+			assert.NoError(t, err)
+			assert.Equal(t, MockData{value}, el)
+		}
+	}},
+	{"Close", func(t *testing.T, queue IndexedQueue) {
+		assert.NoError(t, queue.Push(MockData{1}))
+		assert.NoError(t, queue.Close())
+		assert.NoError(t, queue.Close())
+
+		assert.Same(t, ErrQueueClosed, queue.Push(MockData{2}))
+		_, err := queue.Poll()
+		assert.Same(t, ErrQueueClosed, err)
+		_, err = queue.Peek()
+		assert.Same(t, ErrQueueClosed, err)
+		_, err = queue.Get(0)
+		assert.Same(t, ErrQueueClosed, err)
+		_, err = queue.RemoveIf(func(interface{}) bool { return true })
+		assert.Same(t, ErrQueueClosed, err)
+		queue.All()(func(element interface{}, err error) bool {
+			assert.Same(t, ErrQueueClosed, err)
+			return true
+		})
+	}},
+}
+
+func TestFileQueue_Conformance(t *testing.T) {
+	for _, c := range conformanceCases {
+		t.Run(c.name, func(t *testing.T) {
+			forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+				c.test(t, open())
+			})
+		})
+	}
+}
+
+func TestMemoryQueue_Conformance(t *testing.T) {
+	for _, c := range conformanceCases {
+		t.Run(c.name, func(t *testing.T) {
+			c.test(t, NewMemoryQueue(&MockDataSerializer{}))
+		})
+	}
+}
@@ -39,6 +39,19 @@ func TestNewFileQueue_FromExistingValidFile(t *testing.T) {
 	assert.Equal(t, fileQueue1.writer.header.tail.length, fileQueue2.writer.header.tail.length)
 }
 
+func TestNewStorageQueue_FromExistingStorage(t *testing.T) {
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
+		assert.NoError(t, queue.Push(MockData{12}))
+		assert.NoError(t, queue.Push(MockData{13}))
+
+		newQueue := open()
+		assert.Equal(t, queue.Size(), newQueue.Size())
+		assert.Equal(t, *queue.writer.header.head, *newQueue.writer.header.head)
+		assert.Equal(t, *queue.writer.header.tail, *newQueue.writer.header.tail)
+	})
+}
+
 func TestCheckCorrupt_WrongVersionNumber(t *testing.T) {
 	queueFile := createTestFile()
 	defer deleteFile(queueFile)
@@ -51,12 +64,24 @@ func TestCheckCorrupt_WrongVersionNumber(t *testing.T) {
 	assert.Equal(t, CorruptVersionError, err)
 }
 
+func TestCheckCorrupt_UnknownFlags(t *testing.T) {
+	queueFile := createTestFile()
+	defer deleteFile(queueFile)
+
+	_, err := queueFile.Write([]byte{0, 0, 0, byte(MagicVersionNumber), 0, 0, 1, 0})
+	assert.NoError(t, err)
+
+	_, err = checkCorrupt(queueFile)
+
+	assert.Equal(t, ErrIncompatibleFlags, err)
+}
+
 func TestCheckCorrupt_NoElementCount(t *testing.T) {
 	queueFile := createTestFile()
 	defer deleteFile(queueFile)
 
 	//version
-	_, err := queueFile.Write([]byte{0, 0, 0, 35})
+	_, err := queueFile.Write([]byte{0, 0, 0, 36})
 	// flags
 	_, err = queueFile.Write([]byte{0, 0, 0, 0})
 	assert.NoError(t, err)
@@ -98,7 +123,7 @@ func TestCheckCorrupt_OneDataElementNotMatchingDataLength(t *testing.T) {
 	queueFile := createTestFile()
 	defer deleteFile(queueFile)
 
-	_, err := queueFile.Write([]byte{0, 0, 0, 35})
+	_, err := queueFile.Write([]byte{0, 0, 0, 36})
 	_, err = queueFile.Write([]byte{0, 0, 0, 0, 0, 0, 0, 1})
 	mockData := MockData{
 		value: 14,
@@ -125,11 +150,11 @@ func TestCheckCorrupt_OneDataElement(t *testing.T) {
 		version:      MagicVersionNumber,
 		flags:        0,
 		head: &elementPtr{
-			offset: 32,
+			offset: 48,
 			length: -1,
 		},
 		tail: &elementPtr{
-			offset: 32,
+			offset: 48,
 			length: -1,
 		},
 	}
@@ -144,111 +169,108 @@ func TestCheckCorrupt_OneDataElement(t *testing.T) {
 }
 
 func TestFileQueue_Push2elements(t *testing.T) {
-	queue, err := NewFileQueue("some-queue", &MockDataSerializer{})
-	defer queue.Delete()
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
 
-	assert.NoError(t, err)
-	assert.Equal(t, int64(0), queue.Size())
+		assert.Equal(t, int64(0), queue.Size())
 
-	queue.Push(&MockData{value: 12})
-	queue.Push(&MockData{value: 13})
+		queue.Push(&MockData{value: 12})
+		queue.Push(&MockData{value: 13})
 
-	assert.Equal(t, int64(2), queue.Size())
+		assert.Equal(t, int64(2), queue.Size())
 
-	fq := queue.(*FileQueue)
-	assert.Equal(t, int64(32), fq.writer.header.head.offset)
-	assert.Equal(t, int64(44), fq.writer.header.tail.offset)
+		assert.Equal(t, int64(48), queue.writer.header.head.offset)
+		assert.Equal(t, int64(60), queue.writer.header.tail.offset)
+	})
 }
 
 func TestFileQueue_Push(t *testing.T) {
-	queue, err := NewFileQueue("some-queue", &MockDataSerializer{})
-	defer queue.Delete()
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
 
-	assert.NoError(t, err)
-	assert.Equal(t, int64(0), queue.Size())
+		assert.Equal(t, int64(0), queue.Size())
 
-	queue.Push(&MockData{value: 12})
+		queue.Push(&MockData{value: 12})
 
-	assert.Equal(t, int64(1), queue.Size())
+		assert.Equal(t, int64(1), queue.Size())
+	})
 }
 
 func TestFileQueue_PeekEmptyQueue(t *testing.T) {
-	queue, err := NewFileQueue("some-queue", &MockDataSerializer{})
-	defer queue.Delete()
-
-	assert.NoError(t, err)
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
 
-	_, err = queue.Peek()
-	assert.Same(t, EmptyQueueError, err)
+		_, err := queue.Peek()
+		assert.Same(t, EmptyQueueError, err)
+	})
 }
 
 func TestFileQueue_PeekQueue(t *testing.T) {
-	queue, err := NewFileQueue("some-queue", &MockDataSerializer{})
-	defer queue.Delete()
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
 
-	assert.NoError(t, err)
-	mockData := MockData{123}
+		mockData := MockData{123}
 
-	queue.Push(&mockData)
+		queue.Push(&mockData)
 
-	el, err := queue.Peek()
+		el, err := queue.Peek()
 
-	assert.NoError(t, err)
-	mockDataInstance := (el).(MockData)
-	assert.Equal(t, mockData.value, mockDataInstance.value)
+		assert.NoError(t, err)
+		mockDataInstance := (el).(MockData)
+		assert.Equal(t, mockData.value, mockDataInstance.value)
+	})
 }
 
 func TestFileQueue_PollEmptyQueue(t *testing.T) {
-	queue, err := NewFileQueue("some-queue", &MockDataSerializer{})
-	defer queue.Delete()
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
 
-	assert.NoError(t, err)
-
-	_, err = queue.Poll()
-	assert.Same(t, EmptyQueueError, err)
+		_, err := queue.Poll()
+		assert.Same(t, EmptyQueueError, err)
+	})
 }
 
 func TestFileQueue_PollQueue(t *testing.T) {
-	queue, err := NewFileQueue("some-queue", &MockDataSerializer{})
-	defer queue.Delete()
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
 
-	assert.NoError(t, err)
-	mockData := MockData{123}
+		mockData := MockData{123}
 
-	queue.Push(&mockData)
+		queue.Push(&mockData)
 
-	el, err := queue.Poll()
+		el, err := queue.Poll()
 
-	assert.NoError(t, err)
-	mockDataInstance := (el).(MockData)
-	assert.Equal(t, mockData.value, mockDataInstance.value)
-	assert.Equal(t, int64(0), queue.Size())
+		assert.NoError(t, err)
+		mockDataInstance := (el).(MockData)
+		assert.Equal(t, mockData.value, mockDataInstance.value)
+		assert.Equal(t, int64(0), queue.Size())
+	})
 }
 
 func TestFileQueue_PollQueueKeepsOrder(t *testing.T) {
-	queue, err := NewFileQueue("some-queue", &MockDataSerializer{})
-	defer queue.Delete()
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
 
-	assert.NoError(t, err)
-	mockDataFirst := MockData{1}
-	mockDataSecond := MockData{2}
+		mockDataFirst := MockData{1}
+		mockDataSecond := MockData{2}
 
-	_ = queue.Push(&mockDataFirst)
-	_ = queue.Push(&mockDataSecond)
+		_ = queue.Push(&mockDataFirst)
+		_ = queue.Push(&mockDataSecond)
 
-	el, err := queue.Poll()
+		el, err := queue.Poll()
 
-	assert.NoError(t, err)
-	mockDataInstance := (el).(MockData)
-	assert.Equal(t, mockDataFirst.value, mockDataInstance.value)
-	assert.Equal(t, int64(1), queue.Size())
+		assert.NoError(t, err)
+		mockDataInstance := (el).(MockData)
+		assert.Equal(t, mockDataFirst.value, mockDataInstance.value)
+		assert.Equal(t, int64(1), queue.Size())
 
-	el, err = queue.Poll()
+		el, err = queue.Poll()
 
-	assert.NoError(t, err)
-	mockDataInstance = (el).(MockData)
-	assert.Equal(t, mockDataSecond.value, mockDataInstance.value)
-	assert.Equal(t, int64(0), queue.Size())
+		assert.NoError(t, err)
+		mockDataInstance = (el).(MockData)
+		assert.Equal(t, mockDataSecond.value, mockDataInstance.value)
+		assert.Equal(t, int64(0), queue.Size())
+	})
 }
 
 func TestFileQueue_BulkPushPoll(t *testing.T) {
@@ -257,30 +279,30 @@ func TestFileQueue_BulkPushPoll(t *testing.T) {
 	for i := 0; i < elementCount; i++ {
 		elements = append(elements, MockData{int32(i)})
 	}
-	queue, err := NewFileQueue("some-queue", &MockDataSerializer{})
-	defer queue.Delete()
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
 
-	assert.NoError(t, err)
-	for _, element := range elements {
-		assert.NoError(t, queue.Push(element))
-	}
+		for _, element := range elements {
+			assert.NoError(t, queue.Push(element))
+		}
 
-	for i := 0; i < elementCount; i++ {
-		curElement, err := queue.Peek()
-		assert.NoError(t, err)
+		for i := 0; i < elementCount; i++ {
+			curElement, err := queue.Peek()
+			assert.NoError(t, err)
 
-		curElementCast := (curElement).(MockData)
-		assert.Equal(t, int32(i), curElementCast.value)
+			curElementCast := (curElement).(MockData)
+			assert.Equal(t, int32(i), curElementCast.value)
 
-		curElement, err = queue.Poll()
-		assert.NoError(t, err)
-		assert.Equal(t, int64(elementCount-i-1), queue.Size())
+			curElement, err = queue.Poll()
+			assert.NoError(t, err)
+			assert.Equal(t, int64(elementCount-i-1), queue.Size())
 
-		curElementCast = (curElement).(MockData)
-		assert.Equal(t, int32(i), curElementCast.value)
-	}
+			curElementCast = (curElement).(MockData)
+			assert.Equal(t, int32(i), curElementCast.value)
+		}
 
-	assert.Equal(t, int64(0), queue.Size())
+		assert.Equal(t, int64(0), queue.Size())
+	})
 }
 
 // tests Utilities
@@ -315,6 +337,25 @@ func (m *MockDataSerializer) Read(reader io.Reader) interface{} {
 	return mockData
 }
 
+// serializes ints without allocating, the ints below 256 are also boxed without allocating.
+type AppendIntSerializer struct {
+	buffer [8]byte
+}
+
+func (a *AppendIntSerializer) Write(i interface{}) []byte {
+	return a.AppendTo(nil, i)
+}
+
+func (a *AppendIntSerializer) AppendTo(dst []byte, i interface{}) []byte {
+	value := int64(i.(int))
+	return append(dst, byte(value>>56), byte(value>>48), byte(value>>40), byte(value>>32), byte(value>>24), byte(value>>16), byte(value>>8), byte(value))
+}
+
+func (a *AppendIntSerializer) Read(reader io.Reader) interface{} {
+	_, _ = reader.Read(a.buffer[:])
+	return int(getLong(a.buffer[:]))
+}
+
 func toBytes64(value int64) []byte {
 	buffer := make([]byte, 8)
 	buffer[0] = byte(value >> 56)
@@ -337,14 +378,108 @@ func toBytes(value int32) []byte {
 }
 
 // removes the queue test file
-func deleteFile(file *os.File) {
+func deleteFile(file *FileStorage) {
 	os.Remove(file.Name())
 }
 
-func createTestFile() *os.File {
-	file, err := os.OpenFile("queue", os.O_CREATE|os.O_RDWR, 0755)
+func createTestFile() *FileStorage {
+	file, err := OpenFileStorage("queue")
 	if err != nil {
 		panic(err)
 	}
 	return file
 }
+
+func TestFileQueue_Get(t *testing.T) {
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
+
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, queue.Push(MockData{int32(i)}))
+		}
+		_, err := queue.Poll()
+		assert.NoError(t, err)
+
+		for _, i := range []int64{0, 4, 5, 8, 2} {
+			el, err := queue.Get(i)
+			assert.NoError(t, err)
+			assert.Equal(t, int32(i+1), el.(MockData).value)
+		}
+		_, err = queue.Get(9)
+		assert.Same(t, ErrIndexOutOfBounds, err)
+		_, err = queue.Get(-1)
+		assert.Same(t, ErrIndexOutOfBounds, err)
+		assert.Equal(t, int64(9), queue.Size())
+	})
+}
+
+func TestFileQueue_PushPollDoNotAllocate(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not stable with the race detector")
+	}
+	forEachBackend(t, &AppendIntSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, queue.Push(i))
+		}
+
+		i := 0
+		allocs := testing.AllocsPerRun(1000, func() {
+			if err := queue.Push(i % 200); err != nil {
+				panic(err)
+			}
+			el, err := queue.Peek()
+			if err != nil {
+				panic(err)
+			}
+			if _, err = queue.Poll(); err != nil {
+				panic(err)
+			}
+			optimisationPreventer = el
+			i++
+		})
+		assert.Equal(t, float64(0), allocs)
+	})
+}
+
+func TestFileQueue_PushWithoutAppendSerializer(t *testing.T) {
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
+		queue.SetReadAheadSize(0)
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, queue.Push(MockData{int32(i)}))
+		}
+		for i := 0; i < 10; i++ {
+			el, err := queue.Poll()
+			assert.NoError(t, err)
+			assert.Equal(t, MockData{int32(i)}, el)
+		}
+	})
+}
+
+func TestFileQueue_CloseAndDelete(t *testing.T) {
+	queue, err := OpenFileQueue("closed-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.NoError(t, queue.Push(MockData{1}))
+	assert.NoError(t, queue.Close())
+	_, err = queue.Info()
+	assert.Same(t, ErrQueueClosed, err)
+	assert.Same(t, ErrQueueClosed, queue.Snapshot("closed-queue-snapshot"))
+
+	// the closed file can be reopened, and deleting a queue closes it.
+	restored, err := OpenFileQueue("closed-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), restored.Size())
+	assert.NoError(t, restored.Delete())
+	assert.Same(t, ErrQueueClosed, restored.Push(MockData{2}))
+	_, err = os.Stat("closed-queue")
+	assert.True(t, os.IsNotExist(err))
+
+	// deleting a closed queue still removes the file.
+	reopened, err := OpenFileQueue("closed-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.NoError(t, reopened.Close())
+	assert.NoError(t, reopened.Delete())
+	_, err = os.Stat("closed-queue")
+	assert.True(t, os.IsNotExist(err))
+}
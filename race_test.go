@@ -0,0 +1,7 @@
+//go:build race
+// +build race
+
+package eunomia
+
+// sync.Pool drops items randomly when the race detector is enabled, the allocation tests are skipped.
+const raceEnabled = true
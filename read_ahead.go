@@ -0,0 +1,65 @@
+package eunomia
+
+// Default number of bytes a FileQueue reads ahead of the element it accesses.
+const defaultReadAheadSize int64 = 64 * 1024
+
+// A block of the queue file kept in memory, so that walking the queue from the head (Peek, Poll, iterations) costs
+// one read per block instead of two reads per element.
+// A write overlapping the block drops the whole block instead of updating it. The buffer of a dropped block is reused
+// for the next one, so the data returned by read is only valid until the next read.
+type readAhead struct {
+	offset int64
+	data   []byte
+}
+
+// Returns true if the block holds the `length` bytes starting at the given offset.
+func (r *readAhead) contains(offset, length int64) bool {
+	return len(r.data) > 0 && offset >= r.offset && offset+length <= r.offset+int64(len(r.data))
+}
+
+// Drops the block if the written range overlaps it.
+func (r *readAhead) written(offset, length int64) {
+	if len(r.data) > 0 && offset < r.offset+int64(len(r.data)) && offset+length > r.offset {
+		r.invalidate()
+	}
+}
+
+func (r *readAhead) invalidate() {
+	r.data = r.data[:0]
+}
+
+// Sets the number of bytes read ahead of the accessed elements, a size of 0 disables the read-ahead.
+func (f *FileQueue) SetReadAheadSize(size int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.readAheadSize = size
+	f.ahead.invalidate()
+}
+
+// Reads `length` bytes at the given offset of the file, from the read-ahead block if it holds them.
+// Otherwise a new block is read starting at the offset, up to the end of the live elements, in the buffer of the
+// previous block if it's big enough.
+func (f *FileQueue) read(offset, length int64) ([]byte, error) {
+	if f.ahead.contains(offset, length) {
+		start := offset - f.ahead.offset
+		return f.ahead.data[start : start+length : start+length], nil
+	}
+	blockSize := f.readAheadSize
+	if available := f.liveEnd() - offset; available < blockSize {
+		blockSize = available
+	}
+	if blockSize < length {
+		blockSize = length
+	}
+	data := f.ahead.data[:0]
+	if int64(cap(data)) < blockSize {
+		data = make([]byte, blockSize)
+	}
+	data = data[:blockSize]
+	f.ahead.invalidate()
+	if _, err := f.writer.backingFile.ReadAt(data, offset); err != nil {
+		return nil, err
+	}
+	f.ahead = readAhead{offset: offset, data: data}
+	return data[:length:length], nil
+}
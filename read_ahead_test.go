@@ -0,0 +1,99 @@
+package eunomia
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// counts the reads made on the wrapped storage.
+type countingStorage struct {
+	Storage
+	reads int
+}
+
+func (c *countingStorage) ReadAt(p []byte, offset int64) (int, error) {
+	c.reads++
+	return c.Storage.ReadAt(p, offset)
+}
+
+func TestFileQueue_ReadAheadServesPolls(t *testing.T) {
+	storage := &countingStorage{Storage: NewMemoryStorage()}
+	queue, err := NewStorageQueue(storage, &MockDataSerializer{})
+	assert.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, queue.Push(MockData{int32(i)}))
+	}
+
+	storage.reads = 0
+	for i := 0; i < 100; i++ {
+		el, err := queue.Peek()
+		assert.NoError(t, err)
+		assert.Equal(t, MockData{int32(i)}, el)
+		el, err = queue.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, MockData{int32(i)}, el)
+	}
+	assert.Equal(t, 1, storage.reads)
+}
+
+func TestFileQueue_ReadAheadInvalidatedByWrites(t *testing.T) {
+	for _, size := range []int64{0, 16, defaultReadAheadSize} {
+		queue, err := NewStorageQueue(NewMemoryStorage(), &MockDataSerializer{})
+		assert.NoError(t, err)
+		queue.SetReadAheadSize(size)
+
+		assert.NoError(t, queue.Push(MockData{1}))
+		assert.NoError(t, queue.Push(MockData{2}))
+		_, err = queue.Peek()
+		assert.NoError(t, err)
+		_, err = queue.Poll()
+		assert.NoError(t, err)
+		_, err = queue.Poll()
+		assert.NoError(t, err)
+
+		// the queue is drained, the next element overwrites the bytes of the last polled one.
+		assert.NoError(t, queue.Push(MockData{3}))
+		el, err := queue.Peek()
+		assert.NoError(t, err)
+		assert.Equal(t, MockData{3}, el)
+
+		_, err = queue.ReplaceIf(func(el interface{}) bool {
+			return true
+		}, func(el interface{}) interface{} {
+			return MockData{4}
+		})
+		assert.NoError(t, err)
+		el, err = queue.Peek()
+		assert.NoError(t, err)
+		assert.Equal(t, MockData{4}, el)
+
+		assert.NoError(t, queue.prepend([][]byte{(&MockDataSerializer{}).Write(MockData{5})}))
+		for _, expected := range []int32{5, 4} {
+			el, err = queue.Poll()
+			assert.NoError(t, err)
+			assert.Equal(t, MockData{expected}, el)
+		}
+	}
+}
+
+func TestFileQueue_SmallReadAhead(t *testing.T) {
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		queue := open()
+		queue.SetReadAheadSize(20)
+		for i := 0; i < 50; i++ {
+			assert.NoError(t, queue.Push(MockData{int32(i)}))
+		}
+		for i := 0; i < 50; i++ {
+			el, err := queue.Get(int64(i))
+			assert.NoError(t, err)
+			assert.Equal(t, MockData{int32(i)}, el)
+		}
+		for i := 0; i < 50; i++ {
+			el, err := queue.Poll()
+			assert.NoError(t, err)
+			assert.Equal(t, MockData{int32(i)}, el)
+			assert.NoError(t, queue.Push(MockData{int32(i + 50)}))
+		}
+		assert.Equal(t, int64(50), queue.Size())
+	})
+}
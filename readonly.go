@@ -0,0 +1,90 @@
+package eunomia
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrReadOnly = errors.New("the queue was opened read-only")
+
+// Returned by the operations modifying a queue opened read-only, it matches ErrReadOnly:
+//
+//	if errors.Is(err, eunomia.ErrReadOnly) {
+//		...
+//	}
+type ReadOnlyError struct {
+	// the file of the queue, empty for the queues written to a Storage.
+	Path string
+}
+
+func (e *ReadOnlyError) Error() string {
+	if e.Path == "" {
+		return ErrReadOnly.Error()
+	}
+	return fmt.Sprintf("cannot modify %s: %s", e.Path, ErrReadOnly)
+}
+
+func (e *ReadOnlyError) Is(target error) bool {
+	return target == ErrReadOnly
+}
+
+// Opens an existing queue file read-only (O_RDONLY), for the processes observing a queue written by another one.
+// Size, Peek, Get, the iterators and Info work as usual, while every operation modifying the queue fails with a
+// *ReadOnlyError. The handle does not see the changes made by the writer until Refresh is called.
+func OpenReadOnly(filePath string, serializer Serializer, opts ...Option) (*FileQueue, error) {
+	return OpenFileQueue(filePath, serializer, append(opts, WithReadOnly())...)
+}
+
+// Same as the writable check of the writer, with the path of the queue in the *ReadOnlyError.
+func (f *FileQueue) writable() error {
+	err := f.writer.writable()
+	if readOnly, ok := err.(*ReadOnlyError); ok {
+		readOnly.Path = f.filePath
+	}
+	return err
+}
+
+// Re-reads the header of a queue opened read-only from the file, to see the elements pushed and polled by the
+// process writing it since the queue was opened or last refreshed. The header of a writable queue is always up to
+// date, refreshing it does nothing.
+// The iterators created before the refresh continue from the new head, since the polled elements cannot be told apart
+// from the moved ones, and the snapshot iterators stop.
+func (f *FileQueue) Refresh() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.writer.checkOpen(); err != nil {
+		return err
+	}
+	if !f.writer.openedReadOnly {
+		return nil
+	}
+	current := f.writer.header
+	refreshed, err := checkCorrupt(f.writer.backingFile)
+	if err != nil {
+		return err
+	}
+	if refreshed == nil {
+		// the file was truncated, or deleted and recreated by the writer.
+		return NewFileError
+	}
+	if refreshed.flags != current.flags {
+		return ErrIncompatibleFlags
+	}
+	if refreshed.updatedAt == current.updatedAt && refreshed.head.offset == current.head.offset &&
+		refreshed.tail.offset == current.tail.offset && refreshed.elementCount == current.elementCount {
+		return nil
+	}
+	// the new indexes start after the old tail, like in Restore.
+	index := current.tail.index + 1
+	refreshed.head.index = index
+	refreshed.tail.index = index
+	if refreshed.elementCount > 0 {
+		refreshed.tail.index = index + refreshed.elementCount - 1
+	}
+	f.writer.header = refreshed
+	f.writer.readOnly = refreshed.version > MagicVersionNumber
+	f.moves++
+	f.cursor = nil
+	f.ahead.invalidate()
+	return nil
+}
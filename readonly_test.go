@@ -0,0 +1,117 @@
+package eunomia
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOnly_OpenReadOnly(t *testing.T) {
+	defer os.Remove("readonly-queue")
+	_, err := OpenReadOnly("readonly-queue", &MockDataSerializer{})
+	assert.True(t, os.IsNotExist(err))
+
+	queue, err := OpenFileQueue("readonly-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer queue.Close()
+	for i := int32(0); i < 3; i++ {
+		assert.NoError(t, queue.Push(MockData{i}))
+	}
+
+	monitor, err := OpenReadOnly("readonly-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer monitor.Close()
+	assert.Equal(t, int64(3), monitor.Size())
+	el, err := monitor.Peek()
+	assert.NoError(t, err)
+	assert.Equal(t, MockData{0}, el)
+	el, err = monitor.Get(2)
+	assert.NoError(t, err)
+	assert.Equal(t, MockData{2}, el)
+	var elements []interface{}
+	it := monitor.Iterator()
+	for it.Next() {
+		elements = append(elements, it.Value())
+	}
+	assert.NoError(t, it.Err())
+	assert.Equal(t, []interface{}{MockData{0}, MockData{1}, MockData{2}}, elements)
+	info, err := monitor.Info()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), info.Size)
+}
+
+func TestReadOnly_MutationsFail(t *testing.T) {
+	defer os.Remove("readonly-queue")
+	queue, err := OpenFileQueue("readonly-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.NoError(t, queue.Push(MockData{1}))
+	assert.NoError(t, queue.Close())
+
+	monitor, err := OpenReadOnly("readonly-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer monitor.Close()
+	err = monitor.Push(MockData{2})
+	var readOnly *ReadOnlyError
+	assert.True(t, errors.As(err, &readOnly))
+	assert.Equal(t, "readonly-queue", readOnly.Path)
+	assert.True(t, errors.Is(err, ErrReadOnly))
+	_, err = monitor.Poll()
+	assert.True(t, errors.Is(err, ErrReadOnly))
+	_, err = monitor.RemoveIf(func(interface{}) bool { return true })
+	assert.True(t, errors.Is(err, ErrReadOnly))
+	assert.True(t, errors.Is(monitor.Purge(), ErrReadOnly))
+	assert.True(t, errors.Is(monitor.Delete(), ErrReadOnly))
+	_, err = os.Stat("readonly-queue")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), monitor.Size())
+}
+
+func TestReadOnly_Refresh(t *testing.T) {
+	defer os.Remove("readonly-queue")
+	queue, err := OpenFileQueue("readonly-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer queue.Close()
+	assert.NoError(t, queue.Push(MockData{1}))
+
+	monitor, err := OpenReadOnly("readonly-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer monitor.Close()
+	it := monitor.Iterator()
+
+	assert.NoError(t, queue.Push(MockData{2}))
+	assert.NoError(t, queue.Push(MockData{3}))
+	_, err = queue.Poll()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), monitor.Size())
+
+	assert.NoError(t, monitor.Refresh())
+	assert.Equal(t, int64(2), monitor.Size())
+	el, err := monitor.Peek()
+	assert.NoError(t, err)
+	assert.Equal(t, MockData{2}, el)
+	el, err = monitor.Get(1)
+	assert.NoError(t, err)
+	assert.Equal(t, MockData{3}, el)
+	// the iterator continues from the new head.
+	assert.True(t, it.Next())
+	assert.Equal(t, MockData{2}, it.Value())
+
+	// the header is re-read after a compaction moved the elements.
+	_, err = queue.Poll()
+	assert.NoError(t, err)
+	_, err = queue.Compact()
+	assert.NoError(t, err)
+	assert.NoError(t, monitor.Refresh())
+	el, err = monitor.Peek()
+	assert.NoError(t, err)
+	assert.Equal(t, MockData{3}, el)
+
+	// refreshing a writable queue does nothing.
+	assert.NoError(t, queue.Refresh())
+	assert.Equal(t, int64(1), queue.Size())
+
+	assert.NoError(t, monitor.Close())
+	assert.Same(t, ErrQueueClosed, monitor.Refresh())
+}
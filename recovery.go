@@ -0,0 +1,88 @@
+package eunomia
+
+import (
+	"errors"
+	"log"
+	"strings"
+)
+
+var ErrTornTail = errors.New("the tail of the queue file was not fully written")
+
+// Receives the messages of the queues, *log.Logger implements it.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// Logs through the standard log package.
+type stdLogger struct {
+}
+
+func (stdLogger) Printf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+}
+
+// What to do when opening a queue whose header points past the end of the file, which happens when the process dies
+// before the pushed data reaches the disk, or when the file is truncated.
+type RecoveryPolicy int
+
+const (
+	// The elements after the last fully written one are dropped, and the queue is opened.
+	RecoverAuto RecoveryPolicy = iota
+	// Opening the queue fails with ErrTornTail, Repair can be used to recover the file.
+	RecoverStrict
+)
+
+// The recovery of the torn tails, set by WithRecovery and WithLogger.
+type recoveryOptions struct {
+	policy RecoveryPolicy
+	// where to log the dropped elements, the standard logger if nil.
+	logger Logger
+}
+
+// The recovery used when none is given: the torn tails are dropped and logged with the standard logger.
+var defaultRecovery = recoveryOptions{policy: RecoverAuto}
+
+// Returns true if the header points past the end of the file.
+// Only the tail is checked, since it's the last element written, walking the whole file is left to Verify.
+func (w *QueueProtocolWriter) tornTail() (bool, error) {
+	size, err := w.backingFile.Size()
+	if err != nil {
+		return false, err
+	}
+	header := w.header
+	if header.elementCount == 0 {
+		return header.head.offset > size, nil
+	}
+	frameSize := int64(8)
+	if header.flags&FlagTrailingLength != 0 {
+		frameSize = 16
+	}
+	return header.tail.length < 0 || header.tail.offset+frameSize+header.tail.length > size, nil
+}
+
+// Detects a torn tail, and depending on the policy, fails or repairs the file and reloads it's header.
+func (w *QueueProtocolWriter) recover(recovery recoveryOptions) error {
+	torn, err := w.tornTail()
+	if err != nil || !torn {
+		return err
+	}
+	if recovery.policy == RecoverStrict {
+		return ErrTornTail
+	}
+	report, err := repairStorage(w.backingFile)
+	if err != nil {
+		return err
+	}
+	logger := recovery.logger
+	if logger == nil {
+		logger = stdLogger{}
+	}
+	logger.Printf("eunomia: recovered a torn tail, dropped %d elements and truncated %d bytes (%s)",
+		report.DroppedCount, report.TruncatedBytes, strings.Join(report.Problems, ", "))
+	header, err := checkCorrupt(w.backingFile)
+	if err != nil {
+		return err
+	}
+	w.header = header
+	return nil
+}
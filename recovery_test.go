@@ -0,0 +1,90 @@
+package eunomia
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+type recordingLogger struct {
+	messages []string
+}
+
+func (r *recordingLogger) Printf(format string, args ...interface{}) {
+	r.messages = append(r.messages, fmt.Sprintf(format, args...))
+}
+
+func createTornQueue(t *testing.T) {
+	queue, err := OpenFileQueue("torn-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, queue.Push(MockData{int32(i)}))
+	}
+	// the data of the last element never reached the disk.
+	assert.NoError(t, os.Truncate("torn-queue", queue.end()-6))
+}
+
+func TestRecovery_DropsTornTail(t *testing.T) {
+	createTornQueue(t)
+	defer os.Remove("torn-queue")
+
+	logger := &recordingLogger{}
+	queue, err := OpenFileQueue("torn-queue", &MockDataSerializer{}, WithLogger(logger))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), queue.Size())
+	assert.Equal(t, []string{"eunomia: recovered a torn tail, dropped 1 elements and truncated 6 bytes " +
+		"(the element at offset 72 is cut by the end of the file)"}, logger.messages)
+
+	assert.NoError(t, queue.Push(MockData{3}))
+	for _, expected := range []int32{0, 1, 3} {
+		el, err := queue.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, MockData{expected}, el)
+	}
+}
+
+func TestRecovery_Strict(t *testing.T) {
+	createTornQueue(t)
+	defer os.Remove("torn-queue")
+
+	_, err := OpenFileQueue("torn-queue", &MockDataSerializer{}, WithRecovery(RecoverStrict))
+	assert.Same(t, ErrTornTail, err)
+	report, err := Verify("torn-queue")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), report.DeclaredCount)
+}
+
+func TestRecovery_HeaderPastEndOfFile(t *testing.T) {
+	queue, err := OpenFileQueue("torn-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer os.Remove("torn-queue")
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, queue.Push(MockData{int32(i)}))
+	}
+	// none of the elements reached the disk, but the header did.
+	assert.NoError(t, os.Truncate("torn-queue", headerSize))
+
+	logger := &recordingLogger{}
+	restored, err := OpenFileQueue("torn-queue", &MockDataSerializer{}, WithLogger(logger))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), restored.Size())
+	assert.Len(t, logger.messages, 1)
+	assert.NoError(t, restored.Push(MockData{1}))
+	el, err := restored.Peek()
+	assert.NoError(t, err)
+	assert.Equal(t, MockData{1}, el)
+}
+
+func TestRecovery_ValidQueueIsUntouched(t *testing.T) {
+	queue, err := OpenFileQueue("torn-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer os.Remove("torn-queue")
+	assert.NoError(t, queue.Push(MockData{1}))
+
+	logger := &recordingLogger{}
+	restored, err := OpenFileQueue("torn-queue", &MockDataSerializer{}, WithRecovery(RecoverStrict), WithLogger(logger))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), restored.Size())
+	assert.Empty(t, logger.messages)
+}
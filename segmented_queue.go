@@ -0,0 +1,274 @@
+package eunomia
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// Name of the file listing the segments of a SegmentedQueue, in the queue directory.
+	manifestFileName = "manifest"
+	// Extension of the segment files of a SegmentedQueue.
+	segmentExtension = ".segment"
+)
+
+// A Queue implementation storing it's elements across multiple segment files in a directory.
+// Every segment is a regular FileQueue file, elements are pushed to the last segment until it reaches the segment
+// size, at which point a new segment is created, and polled from the first segment, which is deleted as soon as all
+// it's elements are consumed. This keeps the consumed data from piling up in a single ever-growing file.
+//
+// The order of the segments is kept in a manifest file, rewritten atomically whenever a segment is added or removed.
+type SegmentedQueue struct {
+	dirPath     string
+	serializer  Serializer
+	segmentSize int64
+	// oldest segment first.
+	segments []*queueSegment
+	// id of the next segment to be created.
+	nextID int64
+	closed bool
+	mu     sync.Mutex
+}
+
+type queueSegment struct {
+	id    int64
+	queue *FileQueue
+}
+
+// Creates or restores a segmented queue in the given directory.
+// segmentSize is the size in bytes after which a segment stops accepting new elements, an element bigger than the
+// segment size still gets written to it's own segment.
+func NewSegmentedQueue(dirPath string, serializer Serializer, segmentSize int64) (*SegmentedQueue, error) {
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		return nil, err
+	}
+	queue := &SegmentedQueue{
+		dirPath:     dirPath,
+		serializer:  serializer,
+		segmentSize: segmentSize,
+	}
+	ids, nextID, err := readManifest(filepath.Join(dirPath, manifestFileName))
+	if err != nil {
+		return nil, err
+	}
+	queue.nextID = nextID
+	for _, id := range ids {
+		segment, err := queue.openSegment(id)
+		if err != nil {
+			_ = queue.Close()
+			return nil, err
+		}
+		queue.segments = append(queue.segments, segment)
+	}
+	if len(queue.segments) == 0 {
+		if _, err := queue.addSegment(); err != nil {
+			return nil, err
+		}
+	}
+	return queue, nil
+}
+
+func (s *SegmentedQueue) Push(element interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrQueueClosed
+	}
+	last := s.segments[len(s.segments)-1]
+	if last.queue.Size() > 0 && last.queue.end() >= s.segmentSize {
+		segment, err := s.addSegment()
+		if err != nil {
+			return err
+		}
+		last = segment
+	}
+	return last.queue.Push(element)
+}
+
+func (s *SegmentedQueue) Poll() (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrQueueClosed
+	}
+	if err := s.dropConsumedSegments(); err != nil {
+		return nil, err
+	}
+	element, err := s.segments[0].queue.Poll()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.dropConsumedSegments(); err != nil {
+		return nil, err
+	}
+	return element, nil
+}
+
+func (s *SegmentedQueue) Peek() (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrQueueClosed
+	}
+	for _, segment := range s.segments {
+		if segment.queue.Size() > 0 {
+			return segment.queue.Peek()
+		}
+	}
+	return nil, EmptyQueueError
+}
+
+func (s *SegmentedQueue) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	size := int64(0)
+	for _, segment := range s.segments {
+		size += segment.queue.Size()
+	}
+	return size
+}
+
+// Closes the queue, and deletes every segment, the manifest and the queue directory.
+func (s *SegmentedQueue) Delete() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, segment := range s.segments {
+		if err := segment.queue.Delete(); err != nil {
+			return err
+		}
+	}
+	s.segments = nil
+	if err := os.Remove(filepath.Join(s.dirPath, manifestFileName)); err != nil {
+		return err
+	}
+	return os.Remove(s.dirPath)
+}
+
+// Closes every segment, the queue cannot be used afterwards.
+func (s *SegmentedQueue) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, segment := range s.segments {
+		if err := segment.queue.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Removes the fully consumed segments at the start of the queue, the last segment is always kept since it's the one
+// receiving the new elements.
+// The manifest is updated before deleting the segment files, so a crash can leave an orphan segment file behind but
+// never a manifest referencing a deleted segment.
+func (s *SegmentedQueue) dropConsumedSegments() error {
+	dropped := 0
+	for dropped < len(s.segments)-1 && s.segments[dropped].queue.Size() == 0 {
+		dropped++
+	}
+	if dropped == 0 {
+		return nil
+	}
+	consumed := s.segments[:dropped]
+	remaining := s.segments[dropped:]
+	if err := writeManifest(filepath.Join(s.dirPath, manifestFileName), segmentIDs(remaining), s.nextID); err != nil {
+		return err
+	}
+	s.segments = remaining
+	for _, segment := range consumed {
+		if err := segment.queue.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Creates a new segment at the end of the queue, and records it in the manifest.
+func (s *SegmentedQueue) addSegment() (*queueSegment, error) {
+	segment, err := s.openSegment(s.nextID)
+	if err != nil {
+		return nil, err
+	}
+	segments := append(s.segments, segment)
+	if err := writeManifest(filepath.Join(s.dirPath, manifestFileName), segmentIDs(segments), s.nextID+1); err != nil {
+		_ = segment.queue.Delete()
+		return nil, err
+	}
+	s.segments = segments
+	s.nextID++
+	return segment, nil
+}
+
+func (s *SegmentedQueue) openSegment(id int64) (*queueSegment, error) {
+	segmentPath := filepath.Join(s.dirPath, fmt.Sprintf("%d%s", id, segmentExtension))
+	queue, err := OpenFileQueue(segmentPath, s.serializer)
+	if err != nil {
+		return nil, err
+	}
+	return &queueSegment{id: id, queue: queue}, nil
+}
+
+func segmentIDs(segments []*queueSegment) []int64 {
+	ids := make([]int64, len(segments))
+	for i, segment := range segments {
+		ids[i] = segment.id
+	}
+	return ids
+}
+
+// Reads the segment ids listed in the manifest, and the id of the next segment to create.
+// The manifest is written as [nextID, segmentCount, segmentIDs...], a missing manifest means a new queue.
+func readManifest(path string) ([]int64, int64, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+	nextID, err := ReadLong(file, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	count, err := ReadLong(file, 8)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make([]int64, count)
+	for i := range ids {
+		if ids[i], err = ReadLong(file, 16+int64(i)*8); err != nil {
+			return nil, 0, err
+		}
+	}
+	return ids, nextID, nil
+}
+
+// Writes the manifest to a temporary file, and renames it over the previous one.
+func writeManifest(path string, ids []int64, nextID int64) error {
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	currentOffset, err := WriteLong(file, 0, nextID)
+	if err == nil {
+		currentOffset, err = WriteLong(file, currentOffset, int64(len(ids)))
+	}
+	for i := 0; err == nil && i < len(ids); i++ {
+		currentOffset, err = WriteLong(file, currentOffset, ids[i])
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
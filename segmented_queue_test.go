@@ -0,0 +1,97 @@
+package eunomia
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSegmentedQueue_RollsAndDropsSegments(t *testing.T) {
+	// every element takes 12 bytes, so a segment holds 3 elements after the 48 bytes of header.
+	queue, err := NewSegmentedQueue("segmented-queue", &MockDataSerializer{}, 80)
+	assert.NoError(t, err)
+	defer queue.Delete()
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, queue.Push(MockData{int32(i)}))
+	}
+	assert.Equal(t, int64(10), queue.Size())
+	assert.Equal(t, 4, countSegmentFiles(t))
+
+	for i := 0; i < 6; i++ {
+		el, err := queue.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, int32(i), el.(MockData).value)
+	}
+	assert.Equal(t, 2, countSegmentFiles(t))
+
+	for i := 6; i < 10; i++ {
+		el, err := queue.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, int32(i), el.(MockData).value)
+	}
+	_, err = queue.Poll()
+	assert.Same(t, EmptyQueueError, err)
+	assert.Equal(t, 1, countSegmentFiles(t))
+}
+
+func TestSegmentedQueue_Restore(t *testing.T) {
+	queue, err := NewSegmentedQueue("segmented-queue", &MockDataSerializer{}, 80)
+	assert.NoError(t, err)
+
+	for i := 0; i < 7; i++ {
+		assert.NoError(t, queue.Push(MockData{int32(i)}))
+	}
+	_, err = queue.Poll()
+	assert.NoError(t, err)
+
+	restored, err := NewSegmentedQueue("segmented-queue", &MockDataSerializer{}, 80)
+	assert.NoError(t, err)
+	defer restored.Delete()
+	assert.Equal(t, int64(6), restored.Size())
+	info, err := os.Stat(filepath.Join("segmented-queue", manifestFileName))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0), info.Mode().Perm()&0111)
+
+	el, err := restored.Peek()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), el.(MockData).value)
+
+	assert.NoError(t, restored.Push(MockData{7}))
+	for i := 1; i < 8; i++ {
+		el, err := restored.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, int32(i), el.(MockData).value)
+	}
+}
+
+func countSegmentFiles(t *testing.T) int {
+	entries, err := ioutil.ReadDir("segmented-queue")
+	assert.NoError(t, err)
+	count := 0
+	for _, entry := range entries {
+		if entry.Name() != manifestFileName {
+			count++
+		}
+	}
+	return count
+}
+
+func TestSegmentedQueue_Close(t *testing.T) {
+	queue, err := NewSegmentedQueue("segmented-queue", &MockDataSerializer{}, 80)
+	assert.NoError(t, err)
+	for i := 0; i < 7; i++ {
+		assert.NoError(t, queue.Push(MockData{int32(i)}))
+	}
+	assert.NoError(t, queue.Close())
+	assert.Same(t, ErrQueueClosed, queue.Push(MockData{7}))
+	_, err = queue.Poll()
+	assert.Same(t, ErrQueueClosed, err)
+
+	restored, err := NewSegmentedQueue("segmented-queue", &MockDataSerializer{}, 80)
+	assert.NoError(t, err)
+	defer restored.Delete()
+	assert.Equal(t, int64(7), restored.Size())
+}
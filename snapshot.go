@@ -0,0 +1,254 @@
+package eunomia
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Size of the chunks the live elements are copied by.
+const snapshotChunkSize = 1 << 20
+
+// Number of times Snapshot copies the live elements without holding the lock before giving up and holding it.
+const snapshotAttempts = 3
+
+// Writes a point-in-time copy of the queue to the dst file: the elements present in the queue when the snapshot
+// starts, behind a fresh header, without the space left by the polled elements. The copy is written to a temporary
+// file renamed to dst once synced, so dst is either the previous file or the complete snapshot.
+//
+// Pushes and polls are not blocked while the elements are copied: the pushes write after the tail, and the polls only
+// move the head. If the copied range is overwritten during the copy, because the elements were moved (by Compact,
+// Purge, RemoveIf ...) or because the queue was drained and a push reused the offset of the head, the copy is started
+// over, and the last attempt holds the lock of the queue.
+func (f *FileQueue) Snapshot(dst string) error {
+	for attempt := 1; ; attempt++ {
+		locked := attempt == snapshotAttempts
+		f.mu.Lock()
+		if err := f.writer.checkOpen(); err != nil {
+			f.mu.Unlock()
+			return err
+		}
+		current := *f.writer.header
+		head, tail := *current.head, *current.tail
+		current.head, current.tail = &head, &tail
+		end := f.liveEnd()
+		moves := f.moves
+		if !locked {
+			f.mu.Unlock()
+		}
+		err := writeSnapshot(dst, f.writer.backingFile, &current, end)
+		if locked {
+			f.mu.Unlock()
+			return err
+		}
+		f.mu.Lock()
+		moved := f.moves != moves
+		f.mu.Unlock()
+		if !moved {
+			return err
+		}
+	}
+}
+
+// Writes the live elements of the source, described by the given header and ending at end, to the dst file.
+func writeSnapshot(dst string, source Storage, current *header, end int64) error {
+	tmp := dst + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer file.Close()
+	storage := &FileStorage{file}
+	start := dataStart(current.flags)
+	shift := current.head.offset - start
+	snapshot := &header{
+		version:      MagicVersionNumber,
+		flags:        current.flags,
+		createdAt:    time.Now().UnixNano(),
+		elementCount: current.elementCount,
+		head:         &elementPtr{offset: start, length: current.head.length},
+		tail:         &elementPtr{offset: current.tail.offset - shift, length: current.tail.length},
+		maxElements:  current.maxElements,
+		maxBytes:     current.maxBytes,
+	}
+	if current.elementCount == 0 {
+		snapshot.tail.offset = start
+	}
+	if err := writeHeader(storage, snapshot); err != nil {
+		return err
+	}
+	if current.elementCount > 0 {
+		if err := copyChunks(storage, start, source, current.head.offset, end); err != nil {
+			return err
+		}
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// Copies the bytes of the source in [from, to) to the destination, starting at the given offset.
+func copyChunks(dst io.WriterAt, offset int64, source io.ReaderAt, from, to int64) error {
+	for from < to {
+		length := to - from
+		if length > snapshotChunkSize {
+			length = snapshotChunkSize
+		}
+		chunk, err := ReadChunk(source, from, length)
+		if err != nil {
+			return err
+		}
+		if _, err := WriteChunk(dst, offset, chunk); err != nil {
+			return err
+		}
+		from += length
+		offset += length
+	}
+	return nil
+}
+
+// Replaces the elements of the queue with the elements of the src snapshot (or of any queue file), the file is
+// verified before being restored. The capacity of the queue is kept, and it's not enforced on the restored elements.
+// Iterators created before the restore start over from the new head.
+//
+// The restore never leaves the queue empty or partially restored: the restored file is written next to the queue
+// file, synced, and renamed over it. A queue written to a Storage without a path gets the restored elements after the
+// end of the storage instead, and the header is switched to them with a single write, the space of the replaced
+// elements is reclaimed by Compact.
+func (f *FileQueue) Restore(src string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	source := &FileStorage{file}
+	report, err := verifyStorage(source)
+	if err != nil {
+		return err
+	}
+	if !report.Valid() {
+		return fmt.Errorf("cannot restore %s: %s", src, report.Problems[0])
+	}
+	// the elements are copied as they are stored, so they must be checksummed and compressed like the queue ones.
+	if report.Flags&(FlagTrailingLength|FlagLog) != 0 || report.Flags&codecFlags != f.codec {
+		return ErrIncompatibleFlags
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.writable(); err != nil {
+		return err
+	}
+	if f.filePath == "" {
+		return f.restoreInPlace(source, report)
+	}
+	return f.restoreFile(source, report)
+}
+
+// Returns the header of the queue once restored from the verified source, with the elements starting at the given
+// offset. The new indexes start after the old tail, so that the existing iterators see the old elements as polled.
+func (f *FileQueue) restoredHeader(report *VerifyReport, start int64) *header {
+	current := f.writer.header
+	restored := report.header
+	index := current.tail.index + 1
+	restoredHeader := *current
+	restoredHeader.elementCount = restored.elementCount
+	restoredHeader.head = &elementPtr{offset: start, index: index}
+	restoredHeader.tail = &elementPtr{offset: start, index: index}
+	if restored.elementCount > 0 {
+		shift := restored.head.offset - start
+		restoredHeader.head.length = restored.head.length
+		restoredHeader.tail = &elementPtr{
+			offset: restored.tail.offset - shift,
+			length: restored.tail.length,
+			index:  index + restored.elementCount - 1,
+		}
+	}
+	return &restoredHeader
+}
+
+// Writes the restored file next to the queue file, renames it over the queue file, and reopens it.
+func (f *FileQueue) restoreFile(source Storage, report *VerifyReport) error {
+	stat, err := os.Stat(f.filePath)
+	if err != nil {
+		return err
+	}
+	tmp := f.filePath + ".restore"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_RDWR|os.O_TRUNC, stat.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	start := dataStart(f.writer.header.flags)
+	restoredHeader := f.restoredHeader(report, start)
+	err = writeHeader(file, restoredHeader)
+	if err == nil && restoredHeader.elementCount > 0 {
+		err = copyChunks(file, start, source, report.header.head.offset, report.ValidEnd)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, f.filePath); err != nil {
+		return err
+	}
+	// the previous file is gone, the queue is closed if the restored one cannot be reopened.
+	f.moves++
+	f.ahead.invalidate()
+	previous := f.writer.backingFile
+	reopened, err := os.OpenFile(f.filePath, os.O_RDWR, 0)
+	if err != nil {
+		f.writer.close()
+		return err
+	}
+	previous.Close()
+	f.writer.backingFile = &FileStorage{reopened}
+	f.writer.header = restoredHeader
+	f.cursor = nil
+	f.signalSpace()
+	return nil
+}
+
+// Copies the restored elements after the end of the storage, and points the header to them. Nothing is copied for
+// an empty snapshot, the header alone empties the queue.
+func (f *FileQueue) restoreInPlace(source Storage, report *VerifyReport) error {
+	start := dataStart(f.writer.header.flags)
+	if report.header.elementCount > 0 {
+		size, err := f.writer.backingFile.Size()
+		if err != nil {
+			return err
+		}
+		if size > start {
+			start = size
+		}
+	}
+	restoredHeader := f.restoredHeader(report, start)
+	if restoredHeader.elementCount > 0 {
+		if err := copyChunks(f.writer.backingFile, start, source, report.header.head.offset, report.ValidEnd); err != nil {
+			return err
+		}
+		if err := f.writer.backingFile.Sync(); err != nil {
+			return err
+		}
+	}
+	f.moves++
+	f.ahead.invalidate()
+	if err := writeHeader(f.writer.backingFile, restoredHeader); err != nil {
+		return err
+	}
+	f.writer.header = restoredHeader
+	f.cursor = nil
+	f.signalSpace()
+	return f.sync()
+}
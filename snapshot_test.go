@@ -0,0 +1,203 @@
+package eunomia
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileQueue_Snapshot(t *testing.T) {
+	forEachBackend(t, &MockDataSerializer{}, func(t *testing.T, open func() *FileQueue) {
+		defer os.Remove("snapshot-queue")
+		queue := open()
+		for i := int32(0); i < 10; i++ {
+			assert.NoError(t, queue.Push(MockData{i}))
+		}
+		for i := 0; i < 4; i++ {
+			_, err := queue.Poll()
+			assert.NoError(t, err)
+		}
+
+		assert.NoError(t, queue.Snapshot("snapshot-queue"))
+		info, err := os.Stat("snapshot-queue")
+		assert.NoError(t, err)
+		assert.Equal(t, headerSize+6*12, info.Size())
+		report, err := Verify("snapshot-queue")
+		assert.NoError(t, err)
+		assert.True(t, report.Valid())
+		assert.Equal(t, int64(6), report.ValidCount)
+
+		// the snapshot is not affected by the later changes of the queue.
+		assert.NoError(t, queue.Purge())
+		assert.NoError(t, queue.Push(MockData{42}))
+		it := queue.Iterator()
+
+		assert.NoError(t, queue.Restore("snapshot-queue"))
+		assert.Equal(t, int64(6), queue.Size())
+		assert.NoError(t, queue.Push(MockData{10}))
+		values := make([]int32, 0)
+		for it.Next() {
+			values = append(values, it.Value().(MockData).value)
+		}
+		assert.NoError(t, it.Err())
+		assert.Equal(t, []int32{4, 5, 6, 7, 8, 9, 10}, values)
+
+		restored := open()
+		for i := int32(4); i <= 10; i++ {
+			el, err := restored.Poll()
+			assert.NoError(t, err)
+			assert.Equal(t, MockData{i}, el)
+		}
+	})
+}
+
+func TestFileQueue_SnapshotEmpty(t *testing.T) {
+	defer os.Remove("snapshot-queue")
+	queue, err := NewBoundedFileQueue("bounded-queue", &MockDataSerializer{}, Capacity{MaxElements: 5})
+	assert.NoError(t, err)
+	defer queue.Delete()
+	assert.NoError(t, queue.Push(MockData{1}))
+	_, err = queue.Poll()
+	assert.NoError(t, err)
+
+	assert.NoError(t, queue.Snapshot("snapshot-queue"))
+	snapshot, err := OpenFileQueue("snapshot-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), snapshot.Size())
+	assert.Equal(t, int64(5), snapshot.Capacity().MaxElements)
+
+	assert.NoError(t, queue.Push(MockData{2}))
+	assert.NoError(t, queue.Restore("snapshot-queue"))
+	assert.Equal(t, int64(0), queue.Size())
+}
+
+func TestFileQueue_SnapshotConcurrentCompact(t *testing.T) {
+	defer os.Remove("snapshot-queue")
+	queue, err := NewStorageQueue(NewMemoryStorage(), &MockDataSerializer{})
+	assert.NoError(t, err)
+	for i := int32(0); i < 1000; i++ {
+		assert.NoError(t, queue.Push(MockData{i}))
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			if _, err := queue.Poll(); err != nil {
+				t.Error(err)
+			}
+			if _, err := queue.Compact(); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, queue.Snapshot("snapshot-queue"))
+		report, err := Verify("snapshot-queue")
+		assert.NoError(t, err)
+		assert.True(t, report.Valid(), report.Problems)
+	}
+	wg.Wait()
+}
+
+func TestFileQueue_SnapshotConcurrentDrain(t *testing.T) {
+	defer os.Remove("snapshot-queue")
+	queue, err := NewStorageQueue(NewMemoryStorage(), &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.NoError(t, queue.Push(MockData{1}))
+	_, err = queue.Poll()
+	assert.NoError(t, err)
+	// pushing to the drained queue overwrites the last polled element.
+	moves := queue.moves
+	assert.NoError(t, queue.Push(MockData{2}))
+	assert.NotEqual(t, moves, queue.moves)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := int32(0); i < 1000; i++ {
+			if _, err := queue.Poll(); err != nil {
+				t.Error(err)
+			}
+			if err := queue.Push(MockData{i}); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, queue.Snapshot("snapshot-queue"))
+		report, err := Verify("snapshot-queue")
+		assert.NoError(t, err)
+		assert.True(t, report.Valid(), report.Problems)
+		assert.True(t, report.ValidCount <= 1)
+	}
+	wg.Wait()
+}
+
+func TestFileQueue_RestoreReplacesFile(t *testing.T) {
+	defer os.Remove("snapshot-queue")
+	defer os.Remove("restored-queue")
+	queue, err := OpenFileQueue("restored-queue", &MockDataSerializer{}, WithFileMode(0600))
+	assert.NoError(t, err)
+	for i := int32(0); i < 3; i++ {
+		assert.NoError(t, queue.Push(MockData{i}))
+	}
+	assert.NoError(t, queue.Snapshot("snapshot-queue"))
+	for i := int32(3); i < 10; i++ {
+		assert.NoError(t, queue.Push(MockData{i}))
+	}
+
+	assert.NoError(t, queue.Restore("snapshot-queue"))
+	assert.Equal(t, int64(3), queue.Size())
+	info, err := os.Stat("restored-queue")
+	assert.NoError(t, err)
+	assert.Equal(t, headerSize+3*12, info.Size())
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	_, err = os.Stat("restored-queue.restore")
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, queue.Push(MockData{3}))
+	assert.NoError(t, queue.Close())
+
+	reopened, err := OpenFileQueue("restored-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	for i := int32(0); i < 4; i++ {
+		el, err := reopened.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, MockData{i}, el)
+	}
+	assert.NoError(t, reopened.Close())
+}
+
+func TestFileQueue_RestoreInvalidKeepsFile(t *testing.T) {
+	defer os.Remove("snapshot-queue")
+	queue, err := OpenFileQueue("restored-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer queue.Delete()
+	assert.NoError(t, queue.Push(MockData{1}))
+	assert.NoError(t, queue.Snapshot("snapshot-queue"))
+	assert.NoError(t, queue.Push(MockData{2}))
+	assert.NoError(t, os.Truncate("snapshot-queue", headerSize+4))
+
+	assert.Error(t, queue.Restore("snapshot-queue"))
+	assert.Equal(t, int64(2), queue.Size())
+	report, err := Verify("restored-queue")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), report.ValidCount)
+}
+
+func TestFileQueue_RestoreInvalid(t *testing.T) {
+	defer os.Remove("snapshot-queue")
+	queue, err := NewStorageQueue(NewMemoryStorage(), &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.NoError(t, queue.Push(MockData{1}))
+	assert.NoError(t, queue.Push(MockData{2}))
+	assert.NoError(t, queue.Snapshot("snapshot-queue"))
+	assert.NoError(t, os.Truncate("snapshot-queue", headerSize+20))
+
+	assert.Error(t, queue.Restore("snapshot-queue"))
+	assert.Equal(t, int64(2), queue.Size())
+	assert.Error(t, queue.Restore("missing-snapshot"))
+}
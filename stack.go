@@ -0,0 +1,43 @@
+package eunomia
+
+// A LIFO stack backed by a flat file, elements are pushed and popped from the tail of a FileDeque.
+// Stack files and deque files share the same format, so a stack file can be reopened as a deque.
+type FileStack struct {
+	deque *FileDeque
+}
+
+// Creates or restores a stack from the given file path.
+func NewFileStack(filePath string, serializer Serializer) (*FileStack, error) {
+	deque, err := NewFileDeque(filePath, serializer)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStack{deque: deque}, nil
+}
+
+// Pushes the element on top of the stack.
+func (s *FileStack) Push(element interface{}) error {
+	return s.deque.PushBack(element)
+}
+
+// Removes and returns the element on top of the stack.
+func (s *FileStack) Pop() (interface{}, error) {
+	return s.deque.PollBack()
+}
+
+// Returns the element on top of the stack without removing it.
+func (s *FileStack) Peek() (interface{}, error) {
+	return s.deque.PeekBack()
+}
+
+func (s *FileStack) Size() int64 {
+	return s.deque.Size()
+}
+
+func (s *FileStack) Delete() error {
+	return s.deque.Delete()
+}
+
+func (s *FileStack) Close() error {
+	return s.deque.Close()
+}
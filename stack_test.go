@@ -0,0 +1,36 @@
+package eunomia
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFileStack_PushPop(t *testing.T) {
+	stack, err := NewFileStack("some-stack", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer stack.Delete()
+
+	_, err = stack.Pop()
+	assert.Same(t, EmptyQueueError, err)
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, stack.Push(MockData{int32(i)}))
+	}
+	assert.Equal(t, int64(5), stack.Size())
+
+	el, err := stack.Peek()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(4), el.(MockData).value)
+
+	for i := 4; i >= 0; i-- {
+		el, err := stack.Pop()
+		assert.NoError(t, err)
+		assert.Equal(t, int32(i), el.(MockData).value)
+	}
+	assert.Equal(t, int64(0), stack.Size())
+
+	assert.NoError(t, stack.Push(MockData{42}))
+	el, err = stack.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(42), el.(MockData).value)
+}
@@ -0,0 +1,133 @@
+package eunomia
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// The medium the queue file is written to.
+// The queue only relies on positioned reads and writes, so any random access medium can be used as storage, the
+// default being a regular file on disk.
+type Storage interface {
+	io.ReaderAt
+	io.WriterAt
+
+	// Flushes the written data to durable storage.
+	Sync() error
+
+	// Changes the size of the storage, the data past the given size is discarded.
+	Truncate(size int64) error
+
+	// Returns the current size of the storage in bytes.
+	Size() (int64, error)
+
+	Close() error
+}
+
+// A Storage backed by a file on disk, written with pread/pwrite.
+type FileStorage struct {
+	*os.File
+}
+
+// Opens the file at the given path as a storage, creating it if it does not exist.
+func OpenFileStorage(filePath string) (*FileStorage, error) {
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR, 0755) // the queues opened with WithFileMode use their own permissions
+	if err != nil {
+		return nil, err
+	}
+	return &FileStorage{file}, nil
+}
+
+func (s *FileStorage) Size() (int64, error) {
+	info, err := s.Stat()
+	if err != nil {
+		return -1, err
+	}
+	return info.Size(), nil
+}
+
+// Returned by the MemoryStorage for a negative offset or size, like an os.File.
+var errNegativeOffset = errors.New("negative offset")
+
+// A Storage keeping the data in memory, mostly useful for tests and ephemeral queues.
+type MemoryStorage struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{}
+}
+
+func (m *MemoryStorage) ReadAt(p []byte, offset int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+	if offset >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[offset:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m *MemoryStorage) WriteAt(p []byte, offset int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+	if end := offset + int64(len(p)); end > int64(len(m.data)) {
+		m.grow(end)
+	}
+	return copy(m.data[offset:], p), nil
+}
+
+func (m *MemoryStorage) Sync() error {
+	return nil
+}
+
+func (m *MemoryStorage) Truncate(size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if size < 0 {
+		return errNegativeOffset
+	}
+	if size > int64(len(m.data)) {
+		m.grow(size)
+	} else {
+		m.data = m.data[:size]
+	}
+	return nil
+}
+
+func (m *MemoryStorage) Size() (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(len(m.data)), nil
+}
+
+func (m *MemoryStorage) Close() error {
+	return nil
+}
+
+// Extends the data to the given size, filling the new bytes with zeros.
+func (m *MemoryStorage) grow(size int64) {
+	if size <= int64(cap(m.data)) {
+		previous := len(m.data)
+		m.data = m.data[:size]
+		for i := previous; i < len(m.data); i++ {
+			m.data[i] = 0
+		}
+		return
+	}
+	data := make([]byte, size, 2*size)
+	copy(data, m.data)
+	m.data = data
+}
@@ -0,0 +1,184 @@
+//go:build linux
+// +build linux
+
+package eunomia
+
+import (
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// Size by which the mapping of a MmapStorage grows when a write goes past it's end.
+const mmapChunkSize int64 = 1 << 20
+
+// A Storage backed by a memory mapped file, reads and writes are plain memory copies instead of syscalls.
+// The file is mapped in chunks of mmapChunkSize bytes, and the mapping grows when a write goes past it's end.
+// Since the file on disk is as big as the mapping, it's truncated back to the size of the written data on Close. If
+// the process crashed before, the file is still padded with zeros, and it's truncated back to the end of the tail
+// element of the queue when opened. The files of an older version are never padded, they are left to be upgraded by
+// the queue.
+//
+// Written data reaches the disk whenever the kernel flushes the dirty pages, or when Sync is called, use the
+// DurabilitySync policy on the queue to msync after every operation.
+type MmapStorage struct {
+	file *os.File
+	data []byte
+	// size of the written data, the mapping is usually bigger.
+	size   int64
+	closed bool
+	mu     sync.RWMutex
+}
+
+// Opens and maps the file at the given path, creating it if it does not exist.
+func OpenMmapStorage(filePath string) (*MmapStorage, error) {
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR, 0755)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	size := info.Size()
+	if size > 0 {
+		// a file that is not a queue of the current version, or whose header points past the end of the file, is left
+		// as is.
+		header, err := readAnyHeader(&FileStorage{file})
+		if err == nil && readableVersion(header.version) && header.end() < size {
+			if err := file.Truncate(header.end()); err != nil {
+				file.Close()
+				return nil, err
+			}
+			size = header.end()
+		}
+	}
+	storage := &MmapStorage{
+		file: file,
+		size: size,
+	}
+	if err := storage.remap(size); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return storage, nil
+}
+
+func (m *MmapStorage) ReadAt(p []byte, offset int64) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.data == nil {
+		return 0, os.ErrClosed
+	}
+	if offset >= m.size {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[offset:m.size])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m *MmapStorage) WriteAt(p []byte, offset int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		return 0, os.ErrClosed
+	}
+	end := offset + int64(len(p))
+	if end > int64(len(m.data)) {
+		if err := m.remap(end); err != nil {
+			return 0, err
+		}
+	}
+	if end > m.size {
+		m.size = end
+	}
+	return copy(m.data[offset:], p), nil
+}
+
+// Flushes the mapped pages to the file with msync.
+func (m *MmapStorage) Sync() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.data) == 0 {
+		return nil
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&m.data[0])), uintptr(len(m.data)), syscall.MS_SYNC)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func (m *MmapStorage) Truncate(size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		return os.ErrClosed
+	}
+	if size > int64(len(m.data)) {
+		if err := m.remap(size); err != nil {
+			return err
+		}
+	}
+	if size < m.size {
+		// the discarded bytes stay mapped, zero them so that growing again reads zeros like a regular file.
+		for i := size; i < m.size; i++ {
+			m.data[i] = 0
+		}
+	}
+	m.size = size
+	return nil
+}
+
+func (m *MmapStorage) Size() (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.size, nil
+}
+
+// Unmaps the file, and truncates it to the size of the written data. Closing a closed storage does nothing.
+func (m *MmapStorage) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	if m.data != nil {
+		if err := syscall.Munmap(m.data); err != nil {
+			return err
+		}
+		m.data = nil
+	}
+	if err := m.file.Truncate(m.size); err != nil {
+		return err
+	}
+	return m.file.Close()
+}
+
+// Maps the file with a mapping big enough to hold `size` bytes, rounded up to the next chunk.
+// The previous mapping is only released once the new one is created, so it's still usable if the remap fails.
+func (m *MmapStorage) remap(size int64) error {
+	mappedSize := (size/mmapChunkSize + 1) * mmapChunkSize
+	if err := m.file.Truncate(mappedSize); err != nil {
+		return err
+	}
+	data, err := syscall.Mmap(int(m.file.Fd()), 0, int(mappedSize), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	if m.data != nil {
+		if err := syscall.Munmap(m.data); err != nil {
+			syscall.Munmap(data)
+			return err
+		}
+	}
+	m.data = data
+	return nil
+}
@@ -0,0 +1,157 @@
+//go:build linux
+// +build linux
+
+package eunomia
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func init() {
+	testBackends = append(testBackends, testBackend{
+		name: "mmap",
+		setup: func() (func() (Storage, error), func()) {
+			var storage *MmapStorage
+			open := func() (Storage, error) {
+				// the queues close their storage, a closed storage is reopened.
+				if storage != nil && !storage.closed {
+					return storage, nil
+				}
+				var err error
+				storage, err = OpenMmapStorage("mmap-backend-queue")
+				return storage, err
+			}
+			cleanup := func() {
+				if storage != nil {
+					storage.Close()
+				}
+				os.Remove("mmap-backend-queue")
+			}
+			return open, cleanup
+		},
+	})
+}
+
+func TestMmapStorage_GrowsAndTruncatesOnClose(t *testing.T) {
+	storage, err := OpenMmapStorage("mmap-queue")
+	assert.NoError(t, err)
+	defer os.Remove("mmap-queue")
+
+	data := make([]byte, mmapChunkSize+10)
+	data[len(data)-1] = 42
+	_, err = WriteChunk(storage, 8, data)
+	assert.NoError(t, err)
+	size, err := storage.Size()
+	assert.NoError(t, err)
+	assert.Equal(t, mmapChunkSize+18, size)
+	assert.NoError(t, storage.Sync())
+	assert.NoError(t, storage.Close())
+
+	info, err := os.Stat("mmap-queue")
+	assert.NoError(t, err)
+	assert.Equal(t, mmapChunkSize+18, info.Size())
+
+	reopened, err := OpenMmapStorage("mmap-queue")
+	assert.NoError(t, err)
+	defer reopened.Close()
+	value, err := ReadChunk(reopened, mmapChunkSize+17, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(42), value[0])
+}
+
+func TestMmapStorage_QueueSurvivesReopen(t *testing.T) {
+	storage, err := OpenMmapStorage("mmap-queue")
+	assert.NoError(t, err)
+	defer os.Remove("mmap-queue")
+	queue, err := NewStorageQueue(storage, &MockDataSerializer{})
+	assert.NoError(t, err)
+	queue.SetDurability(DurabilitySync)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, queue.Push(MockData{int32(i)}))
+	}
+	_, err = queue.Poll()
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Close())
+
+	storage, err = OpenMmapStorage("mmap-queue")
+	assert.NoError(t, err)
+	defer storage.Close()
+	restored, err := NewStorageQueue(storage, &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(9), restored.Size())
+	el, err := restored.Peek()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), el.(MockData).value)
+}
+
+func TestMmapStorage_PaddingTruncatedAfterCrash(t *testing.T) {
+	storage, err := OpenMmapStorage("mmap-queue")
+	assert.NoError(t, err)
+	defer os.Remove("mmap-queue")
+	queue, err := NewStorageQueue(storage, &MockDataSerializer{})
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, queue.Push(MockData{int32(i)}))
+	}
+	end := queue.end()
+	assert.NoError(t, storage.Sync())
+	// crash: the mapping goes away without the file being truncated.
+	assert.NoError(t, syscall.Munmap(storage.data))
+	assert.NoError(t, storage.file.Close())
+	info, err := os.Stat("mmap-queue")
+	assert.NoError(t, err)
+	assert.Equal(t, mmapChunkSize, info.Size())
+
+	for i := 0; i < 2; i++ {
+		storage, err = OpenMmapStorage("mmap-queue")
+		assert.NoError(t, err)
+		size, err := storage.Size()
+		assert.NoError(t, err)
+		assert.Equal(t, end, size)
+		restored, err := NewStorageQueue(storage, &MockDataSerializer{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), restored.Size())
+		assert.NoError(t, restored.Close())
+		info, err = os.Stat("mmap-queue")
+		assert.NoError(t, err)
+		assert.Equal(t, end, info.Size())
+	}
+}
+
+func TestMmapStorage_LegacyFile(t *testing.T) {
+	frames, tail := legacyFrames(1, 2)
+	writeLegacyFile(t, "mmap-queue", 0, legacyHeaderSize, frames, tail)
+	defer os.Remove("mmap-queue")
+
+	storage, err := OpenMmapStorage("mmap-queue")
+	assert.NoError(t, err)
+	size, err := storage.Size()
+	assert.NoError(t, err)
+	assert.Equal(t, legacyHeaderSize+2*12, size)
+	queue, err := NewStorageQueue(storage, &MockDataSerializer{})
+	assert.NoError(t, err)
+	for i := int32(1); i <= 2; i++ {
+		el, err := queue.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, MockData{i}, el)
+	}
+	assert.NoError(t, queue.Close())
+}
+
+func TestMmapStorage_ClosedFailsWithoutPanicking(t *testing.T) {
+	storage, err := OpenMmapStorage("mmap-queue")
+	assert.NoError(t, err)
+	defer os.Remove("mmap-queue")
+	_, err = storage.WriteAt(make([]byte, 60), 0)
+	assert.NoError(t, err)
+	assert.NoError(t, storage.Close())
+
+	_, err = storage.ReadAt(make([]byte, 60), 0)
+	assert.Equal(t, os.ErrClosed, err)
+	_, err = storage.WriteAt(make([]byte, 60), 0)
+	assert.Equal(t, os.ErrClosed, err)
+	assert.Equal(t, os.ErrClosed, storage.Truncate(0))
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package eunomia
+
+import "errors"
+
+var ErrMmapUnsupported = errors.New("memory mapped storage is only supported on linux")
+
+// Memory mapped storage is only implemented on linux, this placeholder keeps the API the same on every platform.
+type MmapStorage struct {
+	FileStorage
+}
+
+// Always fails with ErrMmapUnsupported on this platform.
+func OpenMmapStorage(filePath string) (*MmapStorage, error) {
+	return nil, ErrMmapUnsupported
+}
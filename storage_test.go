@@ -0,0 +1,150 @@
+package eunomia
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"testing"
+)
+
+// A storage backend the FileQueue tests are run against.
+type testBackend struct {
+	name string
+	// returns a function opening the storage under test, every call giving access to the same data,
+	// and a function removing the storage.
+	setup func() (open func() (Storage, error), cleanup func())
+}
+
+var testBackends = []testBackend{
+	{
+		name: "file",
+		setup: func() (func() (Storage, error), func()) {
+			open := func() (Storage, error) {
+				return OpenFileStorage("backend-queue")
+			}
+			return open, func() { os.Remove("backend-queue") }
+		},
+	},
+	{
+		name: "memory",
+		setup: func() (func() (Storage, error), func()) {
+			storage := NewMemoryStorage()
+			open := func() (Storage, error) {
+				return storage, nil
+			}
+			return open, func() {}
+		},
+	},
+}
+
+// Runs the test against every storage backend, open creates a new queue on the storage under test.
+func forEachBackend(t *testing.T, serializer Serializer, test func(t *testing.T, open func() *FileQueue)) {
+	for _, backend := range testBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			openStorage, cleanup := backend.setup()
+			defer cleanup()
+			test(t, func() *FileQueue {
+				storage, err := openStorage()
+				if err != nil {
+					t.Fatal(err)
+				}
+				queue, err := NewStorageQueue(storage, serializer)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return queue
+			})
+		})
+	}
+}
+
+func TestMemoryStorage_ReadWrite(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	_, err := WriteLong(storage, 8, 42)
+	assert.NoError(t, err)
+	size, err := storage.Size()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(16), size)
+
+	value, err := ReadLong(storage, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), value)
+	value, err = ReadLong(storage, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), value)
+
+	_, err = ReadLong(storage, 12)
+	assert.Equal(t, io.EOF, err)
+
+	_, err = ReadLong(storage, -8)
+	assert.Error(t, err)
+	_, err = WriteLong(storage, -8, 42)
+	assert.Error(t, err)
+	assert.Error(t, storage.Truncate(-1))
+}
+
+func TestMemoryStorage_Truncate(t *testing.T) {
+	storage := NewMemoryStorage()
+	_, err := WriteLong(storage, 0, -1)
+	assert.NoError(t, err)
+
+	assert.NoError(t, storage.Truncate(4))
+	assert.NoError(t, storage.Truncate(8))
+
+	value, err := ReadLong(storage, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1)<<32, value)
+}
+
+// Records the data of the wrapped storage after every write and truncate, each state being what a crash right after
+// the operation would leave on disk.
+type crashStorage struct {
+	*MemoryStorage
+	states [][]byte
+}
+
+func newCrashStorage() *crashStorage {
+	return &crashStorage{MemoryStorage: NewMemoryStorage()}
+}
+
+func (c *crashStorage) WriteAt(p []byte, offset int64) (int, error) {
+	n, err := c.MemoryStorage.WriteAt(p, offset)
+	c.record()
+	return n, err
+}
+
+func (c *crashStorage) Truncate(size int64) error {
+	err := c.MemoryStorage.Truncate(size)
+	c.record()
+	return err
+}
+
+func (c *crashStorage) record() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.states = append(c.states, append([]byte(nil), c.data...))
+}
+
+// Returns the values of the queue restored from every recorded state.
+func (c *crashStorage) restoredValues(t *testing.T) [][]int32 {
+	restored := make([][]int32, 0, len(c.states))
+	for _, state := range c.states {
+		storage := &MemoryStorage{data: state}
+		report, err := verifyStorage(storage)
+		assert.NoError(t, err)
+		assert.True(t, report.Valid(), report.Problems)
+		queue, err := NewStorageQueue(storage, &MockDataSerializer{})
+		if !assert.NoError(t, err) {
+			continue
+		}
+		values := make([]int32, 0)
+		for queue.Size() > 0 {
+			el, err := queue.Poll()
+			assert.NoError(t, err)
+			values = append(values, el.(MockData).value)
+		}
+		restored = append(restored, values)
+	}
+	return restored
+}
@@ -1,12 +1,10 @@
 package eunomia
 
-import "os"
-
-// Returns true if the file does not exist, or empty
-func fileExist(file *os.File) bool {
-	info, err := os.Stat(file.Name())
+// Returns true if the storage already contains some data
+func fileExist(storage Storage) bool {
+	size, err := storage.Size()
 	if err != nil {
-		return os.IsExist(err)
+		return false
 	}
-	return info.Size() > 0
+	return size > 0
 }
@@ -0,0 +1,201 @@
+package eunomia
+
+import (
+	"fmt"
+	"os"
+)
+
+// The result of the structural verification of a queue file.
+type VerifyReport struct {
+	Version int32
+	Flags   int32
+	// size of the file in bytes.
+	FileSize int64
+	// number of elements according to the header.
+	DeclaredCount int64
+	// number of valid elements found walking the file from the head to the tail.
+	ValidCount int64
+	// offset right after the last valid element.
+	ValidEnd int64
+	// description of every problem found, empty if the file is valid.
+	Problems []string
+	// set by Repair if the file was modified.
+	Repaired bool
+	// number of elements Repair dropped from the queue, and number of bytes it truncated from the file.
+	DroppedCount   int64
+	TruncatedBytes int64
+	// offset of the last valid element, -1 if there is none.
+	lastValid int64
+	header    *header
+}
+
+// Returns true if no problem was found.
+func (r *VerifyReport) Valid() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *VerifyReport) problem(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// Walks every element of the queue file from the head to the tail, and checks that every element fits in the file
+// (and matches it's checksum, if the queue has checksums), that the tail is reached and that the number of elements
+// matches the header.
+// Any version of the format the library can read is accepted, the file is never modified.
+func Verify(filePath string) (*VerifyReport, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return verifyStorage(&FileStorage{file})
+}
+
+// Verifies the file and if it's not valid, drops every element after the last valid one: the file is truncated right
+// after it, and a consistent header is written. The returned report describes the problems found before the repair.
+// Only the files of the current version can be repaired.
+func Repair(filePath string) (*VerifyReport, error) {
+	file, err := OpenFileStorage(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return repairStorage(file)
+}
+
+func verifyStorage(file Storage) (*VerifyReport, error) {
+	size, err := file.Size()
+	if err != nil {
+		return nil, err
+	}
+	version, err := ReadInt(file, 0)
+	if err != nil {
+		return nil, err
+	}
+	var header *header
+	start := dataStart(0)
+	switch {
+	case readableVersion(version):
+		header, err = checkCorrupt(file)
+	case version == legacyVersionNumber:
+		header, err = readLegacyHeader(file)
+		start = legacyHeaderSize
+	default:
+		return nil, ErrUnsupportedVersion
+	}
+	if err != nil {
+		return nil, err
+	}
+	if header.flags&FlagBounded != 0 {
+		start += capacitySize
+	}
+	report := &VerifyReport{
+		Version:       header.version,
+		Flags:         header.flags,
+		FileSize:      size,
+		DeclaredCount: header.elementCount,
+		ValidEnd:      header.head.offset,
+		lastValid:     -1,
+		header:        header,
+	}
+	if header.head.offset < start || header.head.offset > size {
+		report.problem("the head offset %d is outside of the data of the file [%d, %d]", header.head.offset, start, size)
+		report.ValidEnd = start
+		return report, nil
+	}
+	if header.elementCount == 0 {
+		if header.head.offset != header.tail.offset {
+			report.problem("the queue is empty but the head offset %d and the tail offset %d differ", header.head.offset, header.tail.offset)
+		}
+		return report, nil
+	}
+	frameSize := int64(8)
+	if header.flags&FlagTrailingLength != 0 {
+		frameSize = 16
+	}
+	offset := header.head.offset
+	for {
+		if offset > header.tail.offset {
+			report.problem("the tail offset %d is not reachable from the head, the element before it ends at %d", header.tail.offset, offset)
+			break
+		}
+		if offset+frameSize > size {
+			report.problem("the element at offset %d is cut by the end of the file", offset)
+			break
+		}
+		length, err := ReadLong(file, offset)
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 || offset+frameSize+length > size {
+			report.problem("the element at offset %d has an invalid length %d", offset, length)
+			break
+		}
+		if header.flags&FlagTrailingLength != 0 {
+			trailing, err := ReadLong(file, offset+8+length)
+			if err != nil {
+				return nil, err
+			}
+			if trailing != length {
+				report.problem("the element at offset %d has a length %d and a trailing length %d", offset, length, trailing)
+				break
+			}
+		}
+		if header.flags&FlagChecksum != 0 {
+			data, err := ReadChunk(file, offset+8, length)
+			if err != nil {
+				return nil, err
+			}
+			if !validChecksum(data) {
+				report.problem("the element at offset %d does not match it's checksum", offset)
+				break
+			}
+		}
+		report.ValidCount++
+		report.lastValid = offset
+		report.ValidEnd = offset + frameSize + length
+		if offset == header.tail.offset {
+			break
+		}
+		offset = report.ValidEnd
+	}
+	if report.Valid() && report.ValidCount != header.elementCount {
+		report.problem("the header declares %d elements, but %d were found", header.elementCount, report.ValidCount)
+	}
+	return report, nil
+}
+
+func repairStorage(file Storage) (*VerifyReport, error) {
+	report, err := verifyStorage(file)
+	if err != nil {
+		return nil, err
+	}
+	if report.Valid() {
+		return report, nil
+	}
+	if report.Version != MagicVersionNumber {
+		return report, ErrUnsupportedVersion
+	}
+	header := report.header
+	if report.lastValid < 0 {
+		header.head.offset = report.ValidEnd
+		header.tail.offset = report.ValidEnd
+	} else {
+		header.tail.offset = report.lastValid
+	}
+	header.elementCount = report.ValidCount
+	if err := writeHeader(file, header); err != nil {
+		return nil, err
+	}
+	if report.ValidEnd < report.FileSize {
+		if err := file.Truncate(report.ValidEnd); err != nil {
+			return nil, err
+		}
+		report.TruncatedBytes = report.FileSize - report.ValidEnd
+	}
+	if report.DeclaredCount > report.ValidCount {
+		report.DroppedCount = report.DeclaredCount - report.ValidCount
+	}
+	report.Repaired = true
+	return report, file.Sync()
+}
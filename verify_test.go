@@ -0,0 +1,158 @@
+package eunomia
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func createVerifyQueue(t *testing.T, count int) *FileQueue {
+	queue, err := OpenFileQueue("verify-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	for i := 0; i < count; i++ {
+		assert.NoError(t, queue.Push(MockData{int32(i)}))
+	}
+	return queue
+}
+
+func TestVerify_ValidQueue(t *testing.T) {
+	queue := createVerifyQueue(t, 5)
+	defer queue.Delete()
+	_, err := queue.Poll()
+	assert.NoError(t, err)
+
+	report, err := Verify("verify-queue")
+	assert.NoError(t, err)
+	assert.True(t, report.Valid(), report.Problems)
+	assert.Equal(t, int64(4), report.DeclaredCount)
+	assert.Equal(t, int64(4), report.ValidCount)
+	assert.Equal(t, queue.end(), report.ValidEnd)
+
+	report, err = Repair("verify-queue")
+	assert.NoError(t, err)
+	assert.False(t, report.Repaired)
+}
+
+func TestVerify_TruncatedFile(t *testing.T) {
+	queue := createVerifyQueue(t, 3)
+	defer queue.Delete()
+	// the last element loses it's last byte.
+	assert.NoError(t, os.Truncate("verify-queue", queue.end()-1))
+
+	report, err := Verify("verify-queue")
+	assert.NoError(t, err)
+	assert.False(t, report.Valid())
+	assert.Equal(t, int64(2), report.ValidCount)
+
+	report, err = Repair("verify-queue")
+	assert.NoError(t, err)
+	assert.True(t, report.Repaired)
+	assert.Equal(t, int64(1), report.DroppedCount)
+	assert.Equal(t, int64(11), report.TruncatedBytes)
+
+	report, err = Verify("verify-queue")
+	assert.NoError(t, err)
+	assert.True(t, report.Valid(), report.Problems)
+	restored, err := NewFileQueue("verify-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), restored.Size())
+	for i := int32(0); i < 2; i++ {
+		el, err := restored.Poll()
+		assert.NoError(t, err)
+		assert.Equal(t, MockData{i}, el)
+	}
+	assert.NoError(t, restored.Push(MockData{5}))
+}
+
+func TestVerify_InvalidLength(t *testing.T) {
+	queue := createVerifyQueue(t, 4)
+	defer queue.Delete()
+	// the third element claims to be bigger than the file.
+	_, err := WriteLong(queue.writer.backingFile, headerSize+24, 1000)
+	assert.NoError(t, err)
+
+	report, err := Repair("verify-queue")
+	assert.NoError(t, err)
+	assert.Len(t, report.Problems, 1)
+	assert.Equal(t, int64(2), report.ValidCount)
+	assert.Equal(t, int64(2), report.DroppedCount)
+
+	restored, err := NewFileQueue("verify-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), restored.Size())
+	el, err := restored.(*FileQueue).Get(1)
+	assert.NoError(t, err)
+	assert.Equal(t, MockData{1}, el)
+}
+
+func TestVerify_WrongElementCount(t *testing.T) {
+	queue := createVerifyQueue(t, 3)
+	defer queue.Delete()
+	queue.writer.header.elementCount = 5
+	assert.NoError(t, writeHeader(queue.writer.backingFile, queue.writer.header))
+
+	report, err := Repair("verify-queue")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"the header declares 5 elements, but 3 were found"}, report.Problems)
+	assert.Equal(t, int64(0), report.TruncatedBytes)
+
+	restored, err := NewFileQueue("verify-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), restored.Size())
+}
+
+func TestVerify_UnreachableTail(t *testing.T) {
+	queue := createVerifyQueue(t, 3)
+	defer queue.Delete()
+	queue.writer.header.tail.offset += 4
+	assert.NoError(t, writeHeader(queue.writer.backingFile, queue.writer.header))
+
+	report, err := Repair("verify-queue")
+	assert.NoError(t, err)
+	assert.False(t, report.Valid())
+	assert.Equal(t, int64(3), report.ValidCount)
+
+	restored, err := NewFileQueue("verify-queue", &MockDataSerializer{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), restored.Size())
+	assert.NoError(t, restored.Push(MockData{3}))
+	el, err := restored.(*FileQueue).Get(3)
+	assert.NoError(t, err)
+	assert.Equal(t, MockData{3}, el)
+}
+
+func TestVerify_DequeTrailingLength(t *testing.T) {
+	deque, err := NewFileDeque("verify-deque", &MockDataSerializer{})
+	assert.NoError(t, err)
+	defer deque.Delete()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, deque.PushBack(MockData{int32(i)}))
+	}
+	report, err := Verify("verify-deque")
+	assert.NoError(t, err)
+	assert.True(t, report.Valid(), report.Problems)
+
+	_, err = WriteLong(deque.writer.backingFile, headerSize+16+12, 7)
+	assert.NoError(t, err)
+	report, err = Repair("verify-deque")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), report.ValidCount)
+
+	restored, err := NewFileDeque("verify-deque", &MockDataSerializer{})
+	assert.NoError(t, err)
+	el, err := restored.PollBack()
+	assert.NoError(t, err)
+	assert.Equal(t, MockData{0}, el)
+}
+
+func TestVerify_LegacyFile(t *testing.T) {
+	frames, tail := legacyFrames(1, 2, 3)
+	writeLegacyFile(t, "legacy-queue", 0, legacyHeaderSize, frames, tail)
+	defer os.Remove("legacy-queue")
+
+	report, err := Verify("legacy-queue")
+	assert.NoError(t, err)
+	assert.True(t, report.Valid(), report.Problems)
+	assert.Equal(t, legacyVersionNumber, report.Version)
+	assert.Equal(t, int64(3), report.ValidCount)
+}